@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/yx-Anbf1a/anbrpc/metadata"
+)
+
+// AuthorizationKey 存放每次调用凭证的元数据key
+const AuthorizationKey = "authorization"
+
+var (
+	ErrUnauthenticated  = errors.New("rpc: unauthenticated")
+	ErrPermissionDenied = errors.New("rpc: permission denied")
+)
+
+// Identity 调用方身份
+type Identity struct {
+	Principal string   `json:"principal"`
+	Roles     []string `json:"roles"`
+}
+
+func (id *Identity) HasRole(role string) bool {
+	if id == nil {
+		return false
+	}
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator 从请求元数据中解析调用方身份
+// 没有凭证时返回 nil, nil，由授权策略决定是否放行匿名调用；凭证格式错误时应返回错误
+type Authenticator interface {
+	Authenticate(md metadata.MD) (*Identity, error)
+}
+
+// TokenAuthenticator 静态 Bearer Token 校验
+type TokenAuthenticator struct {
+	tokens map[string]*Identity
+}
+
+func NewTokenAuthenticator(tokens map[string]*Identity) *TokenAuthenticator {
+	return &TokenAuthenticator{tokens: tokens}
+}
+
+func (a *TokenAuthenticator) Authenticate(md metadata.MD) (*Identity, error) {
+	if md.Get(AuthorizationKey) == "" {
+		return nil, nil
+	}
+	token, ok := BearerToken(md)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	id, ok := a.tokens[token]
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return id, nil
+}
+
+// BearerToken 取出 authorization: Bearer xxx 中的token
+func BearerToken(md metadata.MD) (string, bool) {
+	v := md.Get(AuthorizationKey)
+	if v == "" {
+		return "", false
+	}
+	const prefix = "bearer "
+	if len(v) < len(prefix) || !strings.EqualFold(v[:len(prefix)], prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(v[len(prefix):])
+	return token, token != ""
+}
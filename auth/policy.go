@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+)
+
+// Subjects 按主体或角色匹配，主体 "*" 匹配任意已认证的调用方，不包括匿名调用
+type Subjects struct {
+	Principals []string `json:"principals,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+}
+
+func (s Subjects) empty() bool {
+	return len(s.Principals) == 0 && len(s.Roles) == 0
+}
+
+func (s Subjects) match(id *Identity) bool {
+	for _, p := range s.Principals {
+		if id != nil && (p == "*" || p == id.Principal) {
+			return true
+		}
+	}
+	for _, r := range s.Roles {
+		if id.HasRole(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule 一条方法级规则，Method 形如 "FBoo.Sum"、"FBoo.*" 或 "*"，服务名不带版本，对服务的所有版本生效
+type Rule struct {
+	Method string   `json:"method"`
+	Allow  Subjects `json:"allow"`
+	Deny   Subjects `json:"deny"`
+}
+
+func (r *Rule) matchMethod(serviceMethod string) bool {
+	if r.Method == "*" || r.Method == serviceMethod {
+		return true
+	}
+	if strings.HasSuffix(r.Method, ".*") {
+		return strings.HasPrefix(serviceMethod, r.Method[:len(r.Method)-1])
+	}
+	return false
+}
+
+// Policy 授权策略
+/*
+	1. 按顺序找到第一条匹配方法的规则
+	2. 命中 deny 则拒绝
+	3. allow 不为空时必须命中 allow
+	4. 没有匹配的规则时由 DefaultDeny 决定
+*/
+type Policy struct {
+	DefaultDeny bool   `json:"default_deny"`
+	Rules       []Rule `json:"rules"`
+}
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := new(Policy)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("auth: parse policy error: %w", err)
+	}
+	for i := range p.Rules {
+		if p.Rules[i].Method == "" {
+			return nil, fmt.Errorf("auth: rule %d has empty method", i)
+		}
+	}
+	return p, nil
+}
+
+func (p *Policy) Check(id *Identity, serviceMethod string) error {
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if !r.matchMethod(serviceMethod) {
+			continue
+		}
+		if r.Deny.match(id) {
+			return ErrPermissionDenied
+		}
+		if !r.Allow.empty() && !r.Allow.match(id) {
+			return ErrPermissionDenied
+		}
+		return nil
+	}
+	if p.DefaultDeny {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// Authorizer 持有当前生效的策略，支持从文件或etcd热加载
+type Authorizer struct {
+	policy atomic.Pointer[Policy]
+	path   string
+
+	mu  sync.Mutex
+	cli *clientv3.Client
+
+	logger *zap.Logger
+}
+
+func NewAuthorizer(p *Policy) *Authorizer {
+	a := &Authorizer{logger: zap.NewNop()}
+	if p == nil {
+		p = &Policy{}
+	}
+	a.policy.Store(p)
+	return a
+}
+
+// NewFileAuthorizer 从JSON文件加载策略，之后可调用 Reload 重新加载
+func NewFileAuthorizer(path string) (*Authorizer, error) {
+	a := NewAuthorizer(nil)
+	a.path = path
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// WithLogger 设置记录etcd热加载错误的Logger，默认不输出
+func (a *Authorizer) WithLogger(lg *zap.Logger) {
+	a.logger = lg
+}
+
+func (a *Authorizer) Policy() *Policy {
+	return a.policy.Load()
+}
+
+func (a *Authorizer) Store(p *Policy) {
+	a.policy.Store(p)
+}
+
+// Reload 重新读取策略文件，解析失败时保留旧策略
+func (a *Authorizer) Reload() error {
+	if a.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return err
+	}
+	a.policy.Store(p)
+	return nil
+}
+
+// WatchEtcd 从etcd的key加载策略，并监听后续修改
+func (a *Authorizer) WatchEtcd(endpoints []string, key string) error {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := cli.Get(context.Background(), key)
+	if err != nil {
+		_ = cli.Close()
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		if err = a.storeRaw(kv.Value); err != nil {
+			_ = cli.Close()
+			return err
+		}
+	}
+	a.mu.Lock()
+	a.cli = cli
+	a.mu.Unlock()
+	go a.watcher(cli, key)
+	return nil
+}
+
+func (a *Authorizer) watcher(cli *clientv3.Client, key string) {
+	rch := cli.Watch(context.Background(), key)
+	for wresp := range rch {
+		for _, ev := range wresp.Events {
+			if ev.Type != mvccpb.PUT {
+				continue
+			}
+			if err := a.storeRaw(ev.Kv.Value); err != nil {
+				a.logger.Error("auth: reload policy from etcd error", zap.String("key", key), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (a *Authorizer) storeRaw(data []byte) error {
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return err
+	}
+	a.policy.Store(p)
+	return nil
+}
+
+// Authorize 判断身份能否调用 serviceMethod
+func (a *Authorizer) Authorize(id *Identity, serviceMethod string) error {
+	return a.policy.Load().Check(id, serviceMethod)
+}
+
+func (a *Authorizer) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cli == nil {
+		return nil
+	}
+	err := a.cli.Close()
+	a.cli = nil
+	return err
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/metadata"
+)
+
+const testPolicy = `{
+	"default_deny": true,
+	"rules": [
+		{"method": "FBoo.Sleep", "allow": {"roles": ["admin"]}},
+		{"method": "FBoo.*", "allow": {"principals": ["*"]}, "deny": {"principals": ["mallory"]}}
+	]
+}`
+
+func TestPolicy_Check(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := &Identity{Principal: "alice", Roles: []string{"admin"}}
+	bob := &Identity{Principal: "bob"}
+	mallory := &Identity{Principal: "mallory", Roles: []string{"admin"}}
+
+	cases := []struct {
+		id     *Identity
+		method string
+		deny   bool
+	}{
+		{alice, "FBoo.Sleep", false},
+		{bob, "FBoo.Sleep", true},
+		{bob, "FBoo.Sum", false},
+		{nil, "FBoo.Sum", true},
+		{mallory, "FBoo.Sum", true},
+		{alice, "Other.Call", true},
+	}
+	for _, c := range cases {
+		err := p.Check(c.id, c.method)
+		if c.deny != errors.Is(err, ErrPermissionDenied) {
+			t.Fatalf("Check(%v, %s) = %v, want deny=%v", c.id, c.method, err, c.deny)
+		}
+	}
+}
+
+func TestAuthorizer_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"rules":[{"method":"*","deny":{"principals":["bob"]}}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewFileAuthorizer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := &Identity{Principal: "bob"}
+	if err = a.Authorize(bob, "FBoo.Sum"); err == nil {
+		t.Fatal("expect bob denied")
+	}
+	_ = os.WriteFile(path, []byte(`{"rules":[]}`), 0644)
+	if err = a.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Authorize(bob, "FBoo.Sum"); err != nil {
+		t.Fatal("expect bob allowed after reload:", err)
+	}
+	// 解析失败保留旧策略
+	_ = os.WriteFile(path, []byte(`{`), 0644)
+	if err = a.Reload(); err == nil {
+		t.Fatal("expect parse error")
+	}
+	if err = a.Authorize(bob, "FBoo.Sum"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	a := NewTokenAuthenticator(map[string]*Identity{"t1": {Principal: "alice"}})
+	id, err := a.Authenticate(metadata.Pairs("Authorization", "Bearer t1"))
+	if err != nil || id.Principal != "alice" {
+		t.Fatal("expect alice, got", id, err)
+	}
+	if _, err = a.Authenticate(metadata.Pairs("authorization", "Bearer bad")); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatal("expect unauthenticated, got", err)
+	}
+	if id, err = a.Authenticate(metadata.MD{}); id != nil || err != nil {
+		t.Fatal("expect anonymous, got", id, err)
+	}
+	// 格式错误的凭证不能当作匿名调用
+	for _, v := range []string{"Basic dDE=", "Bearer ", "t1"} {
+		if _, err = a.Authenticate(metadata.Pairs("authorization", v)); !errors.Is(err, ErrUnauthenticated) {
+			t.Fatalf("expect unauthenticated for %q, got %v", v, err)
+		}
+	}
+}
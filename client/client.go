@@ -7,7 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/internal/keepalive"
+	"github.com/yx-Anbf1a/anbrpc/memconn"
+	"github.com/yx-Anbf1a/anbrpc/metadata"
 	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/tracing"
+	"golang.org/x/net/websocket"
 	"io"
 	"log"
 	"net"
@@ -21,8 +26,10 @@ type Call struct {
 	ServiceMethod string // Service.Method
 	Args          interface{}
 	Reply         interface{}
+	Metadata      metadata.MD // 请求元数据
 	Error         error
-	Done          chan *Call // 监听关闭
+	Done          chan *Call    // 监听关闭
+	stream        *ClientStream // 服务端流式调用的接收端
 }
 
 func (call *Call) done() {
@@ -39,6 +46,10 @@ type Client struct {
 	pending  map[uint64]*Call // 存储已经发送但未完成的请求
 	closing  bool             // 用户主动关闭
 	shutdown bool             // 服务器关闭
+	creds    PerRPCCredentials
+	tracer   tracing.Tracer
+	services sync.Map // 供服务端反向调用的服务 name -> *service
+	ka       *keepalive.Keepalive
 }
 
 type ClientResult struct {
@@ -48,6 +59,9 @@ type ClientResult struct {
 
 var ErrShutdown = errors.New("connection is shut down")
 
+// ErrWriteRequest 请求没有完整写出，服务端不会执行方法
+var ErrWriteRequest = errors.New("writing request")
+
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -58,6 +72,20 @@ func (c *Client) Close() error {
 	return c.cc.Close()
 }
 
+// WithCredentials 设置每次调用附带的凭证
+func (c *Client) WithCredentials(creds PerRPCCredentials) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.creds = creds
+}
+
+// WithTracer 为每次 Call 创建客户端span，不设置时只传递ctx中已有的trace
+func (c *Client) WithTracer(tracer tracing.Tracer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tracer = tracer
+}
+
 // IsAlive 客户端是否存活
 func (c *Client) IsAlive() bool {
 	c.mu.Lock()
@@ -78,6 +106,32 @@ func (c *Client) RegisterCall(call *Call) (uint64, error) {
 	return call.Seq, nil
 }
 
+// nextSeq 分配一个不登记到 pending 的序列号，用于单向调用
+func (c *Client) nextSeq() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.shutdown || c.closing {
+		return 0, ErrShutdown
+	}
+	seq := c.seq
+	c.seq++
+	return seq, nil
+}
+
+// busy 是否有未完成的请求
+func (c *Client) busy() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending) > 0
+}
+
+// getCall 获取未完成的请求，不删除，用于流式调用的数据帧
+func (c *Client) getCall(seq uint64) *Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending[seq]
+}
+
 // RemoveCall的作用是删除已经完成的请求并获取这个请求
 func (c *Client) RemoveCall(seq uint64) *Call {
 	c.mu.Lock()
@@ -96,6 +150,14 @@ func (c *Client) TerminateCalls(err error) {
 	c.shutdown = true
 	for _, call := range c.pending {
 		call.Error = err
+		if call.stream != nil {
+			// 连接断开不是流的正常结束
+			if err == io.EOF {
+				call.stream.finish(ErrShutdown)
+			} else {
+				call.stream.finish(err)
+			}
+		}
 		call.done()
 	}
 }
@@ -112,10 +174,35 @@ func (c *Client) receive() {
 			//errChan <- err
 			break
 		}
-		call := c.RemoveCall(h.Seq)
+		c.ka.Read(h.Type != codec.FrameType_PING && h.Type != codec.FrameType_PONG)
+		switch h.Type {
+		case codec.FrameType_PING:
+			// 接收协程不直接写，避免两端同时等待对方读取
+			if err = c.cc.ReadBody(nil, h.BodySize); err == nil {
+				go func() { _ = c.sendFrame(&codec.Header{Type: codec.FrameType_PONG}, nil) }()
+			}
+			continue
+		case codec.FrameType_PONG:
+			err = c.cc.ReadBody(nil, h.BodySize)
+			continue
+		}
+		// 服务端发起的请求，使用独立的序列号
+		if h.Reverse {
+			err = c.handleReverse(&h)
+			continue
+		}
+		// 流数据帧之后还有后续帧，不能删除请求
+		var call *Call
+		if h.Type == codec.FrameType_STREAM_DATA || h.Type == codec.FrameType_WINDOW_UPDATE {
+			call = c.getCall(h.Seq)
+		} else {
+			call = c.RemoveCall(h.Seq)
+		}
 		switch {
 		case call == nil:
 			err = c.cc.ReadBody(nil, h.BodySize)
+		case call.stream != nil:
+			err = call.stream.readFrame(c.cc, &h)
 		case h.Error != "":
 			call.Error = errors.New(h.Error)
 			err = c.cc.ReadBody(nil, h.BodySize)
@@ -130,16 +217,14 @@ func (c *Client) receive() {
 		}
 	}
 	// 接收请求遇到异常关闭
+	c.ka.Stop()
 	c.TerminateCalls(err)
 }
 
 func (c *Client) send(call *Call) {
 	c.sending.Lock()
 	defer c.sending.Unlock()
-	if c.shutdown || c.closing {
-		return
-	}
-	// 注册一个Call
+	// 注册一个Call, 连接关闭时直接返回错误
 	seq, err := c.RegisterCall(call)
 	if err != nil {
 		call.Error = err
@@ -149,37 +234,125 @@ func (c *Client) send(call *Call) {
 	c.header.ServiceMethod = call.ServiceMethod
 	c.header.Seq = call.Seq
 	c.header.Error = ""
+	c.header.Metadata = call.Metadata
 	if err = c.cc.Write(&c.header, call.Args); err != nil {
 		call := c.RemoveCall(seq)
 		if call != nil {
-			call.Error = errors.New("writing request: " + err.Error())
+			call.Error = fmt.Errorf("%w: %v", ErrWriteRequest, err)
 			call.done()
 		}
 	}
 }
 
-func (c *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+// sendFrame 发送流的后续帧，流的请求已经注册，不再分配序列号
+func (c *Client) sendFrame(h *codec.Header, body interface{}) error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	if !c.IsAlive() {
+		return ErrShutdown
+	}
+	return c.cc.Write(h, body)
+}
+
+// cancel 放弃请求，通知服务端取消对应的处理方法
+// 请求已经完成或没有发送成功时不需要通知
+func (c *Client) cancel(seq uint64, serviceMethod string) {
+	if c.RemoveCall(seq) == nil {
+		return
+	}
+	_ = c.sendFrame(&codec.Header{
+		ServiceMethod: serviceMethod,
+		Seq:           seq,
+		Type:          codec.FrameType_CANCEL,
+	}, nil)
+}
+
+// Notify 单向调用，请求写出后立即返回，服务端执行方法但不发送响应，也不会返回方法的错误
+// ctx中的元数据和trace随请求发送
+func (c *Client) Notify(ctx context.Context, serviceMethod string, args interface{}) error {
+	md, err := c.requestMetadata(ctx, serviceMethod)
+	if err != nil {
+		return err
+	}
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	seq, err := c.nextSeq()
+	if err != nil {
+		return err
+	}
+	h := &codec.Header{
+		ServiceMethod: serviceMethod,
+		Seq:           seq,
+		Metadata:      md,
+		OneWay:        true,
+	}
+	if err = c.cc.Write(h, args); err != nil {
+		return fmt.Errorf("%w: %v", ErrWriteRequest, err)
+	}
+	return nil
+}
+
+func newCall(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	if done == nil {
 		done = make(chan *Call, 10)
 	} else if cap(done) == 0 {
 		panic("rpc client: done has no cap")
 	}
-	call := &Call{
+	return &Call{
 		Seq:           0,
 		ServiceMethod: serviceMethod,
 		Args:          args,
 		Reply:         reply,
 		Done:          done,
 	}
+}
+
+func (c *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	call := newCall(serviceMethod, args, reply, done)
 	c.send(call)
 	return call
 }
 
-func (c *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	call := c.Go(serviceMethod, args, reply, make(chan *Call, 1))
+// requestMetadata 合并ctx中的元数据和凭证，ctx中有trace时附带 traceparent
+func (c *Client) requestMetadata(ctx context.Context, serviceMethod string) (metadata.MD, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = tracing.Inject(ctx, md)
+	c.mu.Lock()
+	creds := c.creds
+	c.mu.Unlock()
+	if creds == nil {
+		return md, nil
+	}
+	cmd, err := creds.RequestMetadata(ctx, serviceMethod)
+	if err != nil {
+		return nil, errors.New("rpc client: get request credentials error: " + err.Error())
+	}
+	return metadata.Join(md, cmd), nil
+}
+
+func (c *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) (err error) {
+	c.mu.Lock()
+	tracer := c.tracer
+	c.mu.Unlock()
+	// 客户端span覆盖发送请求到收到响应，traceparent 中是这个span
+	ctx, span := tracing.Start(ctx, tracer, serviceMethod, tracing.WithSpanKind(tracing.SpanKindClient),
+		tracing.WithAttributes(tracing.Attr("rpc.method", serviceMethod)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+	md, err := c.requestMetadata(ctx, serviceMethod)
+	if err != nil {
+		return err
+	}
+	call := newCall(serviceMethod, args, reply, make(chan *Call, 1))
+	call.Metadata = md
+	c.send(call)
 	select {
 	case <-ctx.Done():
-		c.RemoveCall(call.Seq)
+		c.cancel(call.Seq, call.ServiceMethod)
 		return errors.New("rpc client: call failed " + ctx.Err().Error())
 	case call := <-call.Done:
 		return call.Error
@@ -249,6 +422,21 @@ func newClientCodec(cc codec.Codec, opt *option.Option) (*Client, error) {
 		opt:     opt,
 		pending: make(map[uint64]*Call),
 	}
+	var params option.KeepaliveParams
+	if opt != nil {
+		params = opt.Keepalive
+	}
+	client.ka = keepalive.New(params, func() error {
+		return client.sendFrame(&codec.Header{Type: codec.FrameType_PING}, nil)
+	}, func(reason string) {
+		// 对端失联或空闲超时，关闭后接收协程退出并结束所有未完成的请求
+		log.Println("rpc client: close connection:", reason)
+		client.mu.Lock()
+		client.shutdown = true
+		client.mu.Unlock()
+		_ = cc.Close()
+	}, client.busy)
+	client.ka.Start()
 	// 开启接收请求
 	go client.receive()
 	return client, nil
@@ -269,6 +457,25 @@ func NewHTTPClient(conn net.Conn, opt *option.Option) (*Client, error) {
 	return nil, err
 }
 
+// NewWebSocketClient 在conn上完成WebSocket握手，之后通过二进制消息收发帧
+func NewWebSocketClient(conn net.Conn, opt *option.Option) (*Client, error) {
+	host := conn.RemoteAddr().String()
+	config, err := websocket.NewConfig("ws://"+host+option.DefaultWebSocketPath, "http://"+host)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		return nil, err
+	}
+	ws.PayloadType = websocket.BinaryFrame
+	return NewClient(ws, opt)
+}
+
+func DialWebSocket(conn net.Conn, opts ...*option.Option) (*Client, error) {
+	return dial(NewWebSocketClient, conn, opts...)
+}
+
 func DialHTTP(conn net.Conn, opts ...*option.Option) (*Client, error) {
 	return dial(NewHTTPClient, conn, opts...)
 }
@@ -282,8 +489,28 @@ func DDial(protocol string, conn net.Conn, opts ...*option.Option) (*Client, err
 	switch protocol {
 	case "http":
 		return DialHTTP(conn, opts...)
+	case "ws":
+		return DialWebSocket(conn, opts...)
 	default:
 		// tcp, unix or other transport protocol
 		return Dial(conn, opts...)
 	}
 }
+
+// dialTransport 建立底层连接，mem 连接同一进程内的 memconn.Listener
+func dialTransport(network, address string) (net.Conn, error) {
+	if network == memconn.Network {
+		return memconn.Dial(address)
+	}
+	return net.Dial(network, address)
+}
+
+// transportNetwork protocol@addr 中的protocol对应的底层网络，http和ws都建立在tcp之上
+func transportNetwork(protocol string) string {
+	switch protocol {
+	case "http", "ws":
+		return "tcp"
+	default:
+		return protocol
+	}
+}
@@ -0,0 +1,20 @@
+package client
+
+import (
+	"context"
+
+	"github.com/yx-Anbf1a/anbrpc/auth"
+	"github.com/yx-Anbf1a/anbrpc/metadata"
+)
+
+// PerRPCCredentials 每次调用附带的凭证，写入请求头的元数据中
+type PerRPCCredentials interface {
+	RequestMetadata(ctx context.Context, serviceMethod string) (metadata.MD, error)
+}
+
+// BearerToken 以 authorization: Bearer <token> 的形式发送凭证，可以是JWT
+type BearerToken string
+
+func (t BearerToken) RequestMetadata(ctx context.Context, serviceMethod string) (metadata.MD, error) {
+	return metadata.Pairs(auth.AuthorizationKey, "Bearer "+string(t)), nil
+}
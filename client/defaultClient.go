@@ -7,6 +7,7 @@ import (
 	"github.com/yx-Anbf1a/anbrpc/balancer"
 	"github.com/yx-Anbf1a/anbrpc/discovery"
 	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/tracing"
 	"google.golang.org/protobuf/proto"
 	"io"
 	"net"
@@ -24,7 +25,9 @@ type DClient struct {
 	endpoints []string
 	bl        balancer.Balancer
 
-	pools map[string]Pool
+	pools  map[string]Pool
+	creds  PerRPCCredentials
+	tracer tracing.Tracer
 
 	InitialCap int
 	//最大并发存活连接数
@@ -86,6 +89,26 @@ func (dc *DClient) SetBalancer(b balancer.Balancer) {
 	return
 }
 
+// WithCredentials 设置每次调用附带的凭证，作用于之后建立的所有连接
+func (dc *DClient) WithCredentials(creds PerRPCCredentials) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.creds = creds
+	for _, c := range dc.clients {
+		c.WithCredentials(creds)
+	}
+}
+
+// WithTracer 设置每次调用使用的Tracer，作用于之后建立的所有连接
+func (dc *DClient) WithTracer(tracer tracing.Tracer) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.tracer = tracer
+	for _, c := range dc.clients {
+		c.WithTracer(tracer)
+	}
+}
+
 func (dc *DClient) dial(rpcAddr string) (*Client, error) {
 	dc.mu.Lock()
 	defer dc.mu.Unlock()
@@ -110,7 +133,7 @@ func (dc *DClient) dial(rpcAddr string) (*Client, error) {
 				MaxIdle:     dc.MaxIdle,
 				MaxCap:      dc.MaxCap,
 				IdleTimeout: dc.IdleTimeout,
-				Network:     protocol,
+				Network:     transportNetwork(protocol),
 				Address:     addr,
 			}
 			pool, _ = NewChannelPool(&poolOpt)
@@ -127,6 +150,12 @@ func (dc *DClient) dial(rpcAddr string) (*Client, error) {
 		if err != nil {
 			return nil, err
 		}
+		if dc.creds != nil {
+			c.WithCredentials(dc.creds)
+		}
+		if dc.tracer != nil {
+			c.WithTracer(dc.tracer)
+		}
 		dc.clients[rpcAddr] = c
 	}
 	return c, nil
@@ -140,18 +169,91 @@ func (dc *DClient) call(ctx context.Context, rpcAddr, serviceMethod string, args
 	return client.Call(ctx, serviceMethod, args, reply)
 }
 
-func (dc *DClient) Call(ctx context.Context, serviceMethod string, args, reply proto.Message) error {
-	rpcAddr := dc.discovery.GetService()
-	ctx, _ = context.WithTimeout(ctx, time.Second*3)
-	for rpcAddr == "" {
-		rpcAddr = dc.discovery.GetService()
+// pickService 等待并按负载均衡策略选择一个服务实例，返回实例和带上所选版本的方法名
+func (dc *DClient) pickService(ctx context.Context, serviceMethod string) (discovery.Instance, string, error) {
+	method, versions := routeVersions(ctx, serviceMethod)
+	for {
+		for _, version := range versions {
+			if inst := dc.discovery.GetInstance(version); inst.Addr != "" {
+				return inst, versionedMethod(method, version), nil
+			}
+		}
 		//log.Println("wait for service...")
 		select {
 		case <-ctx.Done():
-			return errors.New("no expect service")
+			return discovery.Instance{}, "", errors.New("no expect service")
 		default:
 		}
 	}
+}
+
+// Call 选择一个服务实例调用，服务端为方法设置了超时时使用该超时
+// 幂等的方法在连接失败时换一个实例重试一次
+func (dc *DClient) Call(ctx context.Context, serviceMethod string, args, reply proto.Message) error {
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second*3)
+	defer cancel()
+	inst, method, err := dc.pickService(waitCtx, serviceMethod)
+	if err != nil {
+		return err
+	}
 	//log.Printf("call %s on %s", serviceMethod, rpcAddr)
+	opts := inst.MethodOptions(method)
+	err = dc.callInstance(ctx, waitCtx, inst.Addr, method, opts, args, reply)
+	if err != nil && opts.Idempotent && isTransportError(err) {
+		if inst, method, perr := dc.pickService(waitCtx, serviceMethod); perr == nil {
+			err = dc.callInstance(ctx, waitCtx, inst.Addr, method, opts, args, reply)
+		}
+	}
+	return err
+}
+
+// callInstance 方法没有设置超时时，与等待实例共用同一个超时
+func (dc *DClient) callInstance(ctx, waitCtx context.Context, rpcAddr, serviceMethod string, opts option.MethodOptions, args, reply proto.Message) error {
+	if opts.Timeout <= 0 {
+		return dc.call(waitCtx, rpcAddr, serviceMethod, args, reply)
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
 	return dc.call(ctx, rpcAddr, serviceMethod, args, reply)
 }
+
+// isTransportError 请求没有到达服务端或连接中途断开，方法可能没有执行
+func isTransportError(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, ErrShutdown) || errors.As(err, &opErr) || errors.Is(err, ErrWriteRequest)
+}
+
+// Stream 选择一个服务实例发起服务端流式调用，ctx控制整个流的生命周期
+func (dc *DClient) Stream(ctx context.Context, serviceMethod string, args, reply proto.Message) (*ClientStream, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second*3)
+	inst, serviceMethod, err := dc.pickService(waitCtx, serviceMethod)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	client, err := dc.dial(inst.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return client.Stream(ctx, serviceMethod, args, reply)
+}
+
+// Notify 选择一个服务实例发起单向调用
+func (dc *DClient) Notify(ctx context.Context, serviceMethod string, args proto.Message) error {
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second*3)
+	inst, serviceMethod, err := dc.pickService(waitCtx, serviceMethod)
+	cancel()
+	if err != nil {
+		return err
+	}
+	client, err := dc.dial(inst.Addr)
+	if err != nil {
+		return err
+	}
+	return client.Notify(ctx, serviceMethod, args)
+}
+
+// NewStream 选择一个服务实例发起客户端流或双向流调用
+func (dc *DClient) NewStream(ctx context.Context, serviceMethod string, reply proto.Message) (*ClientStream, error) {
+	return dc.Stream(ctx, serviceMethod, nil, reply)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -79,7 +80,11 @@ func NewChannelPool(poolConfig *PoolOption) (Pool, error) {
 	//	return nil, errors.New("invalid close func settings")
 	//}
 	_factory := func() (interface{}, error) {
-		return net.Dial(poolConfig.Network, poolConfig.Address)
+		conn, err := dialTransport(poolConfig.Network, poolConfig.Address)
+		if err != nil {
+			return nil, err
+		}
+		return &poolConn{Conn: conn}, nil
 	}
 	_close := func(v interface{}) error { return v.(net.Conn).Close() }
 
@@ -94,6 +99,14 @@ func NewChannelPool(poolConfig *PoolOption) (Pool, error) {
 
 	if poolConfig.Ping != nil {
 		c.ping = poolConfig.Ping
+	} else {
+		// 默认丢弃已经被关闭的连接，如客户端保活超时后关闭的连接
+		c.ping = func(v interface{}) error {
+			if pc, ok := v.(*poolConn); ok && pc.isClosed() {
+				return net.ErrClosed
+			}
+			return nil
+		}
 	}
 
 	for i := 0; i < poolConfig.InitialCap; i++ {
@@ -108,6 +121,21 @@ func NewChannelPool(poolConfig *PoolOption) (Pool, error) {
 	return c, nil
 }
 
+// poolConn 记录连接是否已经被关闭
+type poolConn struct {
+	net.Conn
+	closed int32
+}
+
+func (c *poolConn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return c.Conn.Close()
+}
+
+func (c *poolConn) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
 // getConns 获取所有连接
 func (c *channelPool) getConns() chan *idleConn {
 	c.mu.Lock()
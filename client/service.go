@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"go/ast"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// methodType 客户端上可被服务端反向调用的方法
+type methodType struct {
+	method      reflect.Method
+	argType     reflect.Type
+	withContext bool // 第一个参数是 context.Context
+}
+
+// service 注册在客户端连接上的服务，方法签名与服务端的普通方法相同
+//
+//	func (t *T) Method(args *Args) *Reply
+//	func (t *T) Method(ctx context.Context, args *Args) *Reply
+type service struct {
+	name    string
+	rcvr    reflect.Value
+	methods map[string]*methodType
+}
+
+func newService(name string, rcvr interface{}) (*service, error) {
+	s := &service{rcvr: reflect.ValueOf(rcvr), name: name, methods: make(map[string]*methodType)}
+	if s.name == "" {
+		s.name = reflect.Indirect(s.rcvr).Type().Name()
+	}
+	if !ast.IsExported(s.name) {
+		return nil, errors.New("rpc client: " + s.name + " is not a valid service name")
+	}
+	typ := reflect.TypeOf(rcvr)
+	for i := 0; i < typ.NumMethod(); i++ {
+		m := typ.Method(i)
+		mTyp := m.Type
+		withContext := mTyp.NumIn() == 3 && mTyp.In(1) == contextType
+		if mTyp.NumOut() != 1 || (mTyp.NumIn() != 2 && !withContext) {
+			continue
+		}
+		argType := mTyp.In(mTyp.NumIn() - 1)
+		if argType.Kind() != reflect.Ptr || mTyp.Out(0).Kind() != reflect.Ptr {
+			continue
+		}
+		s.methods[m.Name] = &methodType{method: m, argType: argType, withContext: withContext}
+	}
+	if len(s.methods) == 0 {
+		return nil, errors.New("rpc client: " + s.name + " has no suitable methods")
+	}
+	return s, nil
+}
+
+func (s *service) call(ctx context.Context, m *methodType, args reflect.Value) interface{} {
+	in := []reflect.Value{s.rcvr, args}
+	if m.withContext {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), args}
+	}
+	return m.method.Func.Call(in)[0].Interface()
+}
+
+// Register 在连接上注册服务，服务端可以通过同一个连接反向调用
+func (c *Client) Register(rcvr interface{}) error {
+	return c.RegisterName("", rcvr)
+}
+
+// RegisterName 以指定的服务名注册服务，name为空时使用结构体类型名
+func (c *Client) RegisterName(name string, rcvr interface{}) error {
+	svc, err := newService(name, rcvr)
+	if err != nil {
+		return err
+	}
+	if _, dup := c.services.LoadOrStore(svc.name, svc); dup {
+		return errors.New("rpc client: service already defined: " + svc.name)
+	}
+	return nil
+}
+
+// findMethod 查找反向调用的方法
+func (c *Client) findMethod(serviceMethod string) (*service, *methodType, error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return nil, nil, errors.New("rpc client: service/method request ill-formed: " + serviceMethod)
+	}
+	svci, ok := c.services.Load(serviceMethod[:dot])
+	if !ok {
+		return nil, nil, errors.New("rpc client: can't find service " + serviceMethod[:dot])
+	}
+	svc := svci.(*service)
+	m := svc.methods[serviceMethod[dot+1:]]
+	if m == nil {
+		return nil, nil, errors.New("rpc client: can't find method " + serviceMethod[dot+1:])
+	}
+	return svc, m, nil
+}
+
+// handleReverse 接收协程收到服务端发起的请求，读取参数后在新协程中执行，不阻塞接收
+func (c *Client) handleReverse(h *codec.Header) error {
+	svc, m, err := c.findMethod(h.ServiceMethod)
+	if err != nil {
+		if err := c.cc.ReadBody(nil, h.BodySize); err != nil {
+			return err
+		}
+		go c.sendReverse(h, err.Error(), nil)
+		return nil
+	}
+	args := reflect.New(m.argType.Elem())
+	if err = c.cc.ReadBody(args.Interface(), h.BodySize); err != nil {
+		// 参数无法解码但帧边界完好，只回复这次反向调用失败
+		if errors.Is(err, codec.ErrInvalidBody) {
+			go c.sendReverse(h, err.Error(), nil)
+			return nil
+		}
+		return err
+	}
+	go func() {
+		reply := svc.call(context.Background(), m, args)
+		c.sendReverse(h, "", reply)
+	}()
+	return nil
+}
+
+// sendReverse 回复服务端发起的请求
+func (c *Client) sendReverse(req *codec.Header, errMsg string, reply interface{}) {
+	h := &codec.Header{
+		ServiceMethod: req.ServiceMethod,
+		Seq:           req.Seq,
+		Error:         errMsg,
+		Reverse:       true,
+	}
+	if reply == nil {
+		reply = struct{}{}
+	}
+	if err := c.sendFrame(h, reply); err != nil {
+		log.Println("rpc client: write reverse response error:", err)
+	}
+}
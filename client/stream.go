@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"reflect"
+	"sync"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/internal/flow"
+	"github.com/yx-Anbf1a/anbrpc/option"
+)
+
+var ErrStreamClosed = errors.New("rpc client: stream closed")
+
+// ClientStream 流式调用的客户端
+// 接收协程只负责把响应解码入队，不会因为某个流读得慢而阻塞整个连接
+// 客户端流和双向流通过 Send 发送消息，发送窗口用完后阻塞，直到服务端消费后归还额度
+type ClientStream struct {
+	c             *Client
+	ctx           context.Context
+	serviceMethod string
+	seq           uint64
+	replyType     reflect.Type // 响应的指针类型
+	window        *flow.Window // 发送窗口
+	credit        *flow.Credit // 接收额度
+
+	mu         sync.Mutex
+	queue      []interface{}
+	err        error // 结束原因，io.EOF表示正常结束
+	notify     chan struct{}
+	sendClosed bool
+}
+
+func newClientStream(ctx context.Context, c *Client, serviceMethod string, replyType reflect.Type) *ClientStream {
+	window := option.DefaultOption.StreamWindow
+	if c.opt != nil && c.opt.StreamWindow > 0 {
+		window = c.opt.StreamWindow
+	}
+	return &ClientStream{
+		c:             c,
+		ctx:           ctx,
+		serviceMethod: serviceMethod,
+		replyType:     replyType,
+		window:        flow.NewWindow(window),
+		credit:        flow.NewCredit(window),
+		notify:        make(chan struct{}, 1),
+	}
+}
+
+func (s *ClientStream) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *ClientStream) push(reply interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.queue = append(s.queue, reply)
+	s.signal()
+}
+
+// finish 结束流，只记录第一次的原因
+func (s *ClientStream) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.signal()
+	s.window.Close()
+}
+
+// readFrame 接收协程读取一帧
+func (s *ClientStream) readFrame(cc codec.Codec, h *codec.Header) error {
+	switch {
+	case h.Type == codec.FrameType_STREAM_DATA:
+		reply := reflect.New(s.replyType.Elem()).Interface()
+		if err := cc.ReadBody(reply, h.BodySize); err != nil {
+			s.finish(errors.New("reading body " + err.Error()))
+			return err
+		}
+		s.push(reply)
+		return nil
+	case h.Type == codec.FrameType_WINDOW_UPDATE:
+		s.window.Add(int(h.Window))
+	case h.Error != "":
+		s.finish(errors.New(h.Error))
+	case h.Type == codec.FrameType_STREAM_END:
+		s.finish(io.EOF)
+	default:
+		s.finish(errors.New("rpc client: unexpected frame for stream"))
+	}
+	return cc.ReadBody(nil, h.BodySize)
+}
+
+// Recv 按顺序返回下一个响应，流正常结束时返回 io.EOF
+func (s *ClientStream) Recv() (interface{}, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			reply := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			done := s.err != nil
+			s.mu.Unlock()
+			// 流结束后服务端不再发送，无需归还额度
+			if n := s.credit.Consume(); n > 0 && !done {
+				_ = s.c.sendFrame(&codec.Header{
+					ServiceMethod: s.serviceMethod,
+					Seq:           s.seq,
+					Type:          codec.FrameType_WINDOW_UPDATE,
+					Window:        uint32(n),
+				}, nil)
+			}
+			return reply, nil
+		}
+		if s.err != nil {
+			err := s.err
+			s.mu.Unlock()
+			return nil, err
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.notify:
+		case <-s.ctx.Done():
+			s.c.cancel(s.seq, s.serviceMethod)
+			s.finish(errors.New("rpc client: stream failed " + s.ctx.Err().Error()))
+		}
+	}
+}
+
+// Send 发送一条消息，用于客户端流和双向流
+// 窗口用完时阻塞直到服务端归还额度或ctx结束，流结束后返回结束原因
+func (s *ClientStream) Send(args interface{}) error {
+	if err := s.window.Acquire(s.ctx.Done()); err != nil {
+		return s.sendErr()
+	}
+	s.mu.Lock()
+	if s.sendClosed {
+		s.mu.Unlock()
+		return ErrStreamClosed
+	}
+	s.mu.Unlock()
+	return s.c.sendFrame(&codec.Header{
+		ServiceMethod: s.serviceMethod,
+		Seq:           s.seq,
+		Type:          codec.FrameType_STREAM_DATA,
+	}, args)
+}
+
+// sendErr 无法继续发送的原因
+func (s *ClientStream) sendErr() error {
+	if err := s.ctx.Err(); err != nil {
+		return errors.New("rpc client: stream failed " + err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil && s.err != io.EOF {
+		return s.err
+	}
+	return ErrStreamClosed
+}
+
+// CloseSend 结束发送方向，服务端的 Recv 将返回 io.EOF，之后仍可以继续 Recv
+func (s *ClientStream) CloseSend() error {
+	s.mu.Lock()
+	if s.sendClosed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.sendClosed = true
+	s.mu.Unlock()
+	return s.c.sendFrame(&codec.Header{
+		ServiceMethod: s.serviceMethod,
+		Seq:           s.seq,
+		Type:          codec.FrameType_STREAM_END,
+	}, nil)
+}
+
+// CloseAndRecv 客户端流结束发送并等待服务端的唯一响应
+func (s *ClientStream) CloseAndRecv() (interface{}, error) {
+	if err := s.CloseSend(); err != nil {
+		return nil, err
+	}
+	reply, err := s.Recv()
+	if err == io.EOF {
+		return nil, errors.New("rpc client: stream ended without reply")
+	}
+	return reply, err
+}
+
+// All 迭代所有响应，流异常结束时最后返回一次错误
+//
+//	for reply, err := range stream.All() { ... }
+func (s *ClientStream) All() iter.Seq2[interface{}, error] {
+	return func(yield func(interface{}, error) bool) {
+		for {
+			reply, err := s.Recv()
+			if err == io.EOF {
+				return
+			}
+			if !yield(reply, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close 不再接收后续响应，流未结束时通知服务端取消
+func (s *ClientStream) Close() error {
+	s.c.cancel(s.seq, s.serviceMethod)
+	s.finish(ErrStreamClosed)
+	return nil
+}
+
+// Stream 发起服务端流式调用，reply 为响应类型的指针，如 (*FBooReply)(nil)，每次Recv返回一个新的响应
+func (c *Client) Stream(ctx context.Context, serviceMethod string, args, reply interface{}) (*ClientStream, error) {
+	replyType := reflect.TypeOf(reply)
+	if replyType == nil || replyType.Kind() != reflect.Ptr {
+		return nil, errors.New("rpc client: stream reply type must be a pointer")
+	}
+	md, err := c.requestMetadata(ctx, serviceMethod)
+	if err != nil {
+		return nil, err
+	}
+	stream := newClientStream(ctx, c, serviceMethod, replyType)
+	call := newCall(serviceMethod, args, nil, make(chan *Call, 1))
+	call.Metadata = md
+	call.stream = stream
+	c.send(call)
+	// 发送失败时 call 已经完成
+	select {
+	case call := <-call.Done:
+		return nil, call.Error
+	default:
+	}
+	stream.seq = call.Seq
+	return stream, nil
+}
+
+// NewStream 发起客户端流或双向流调用，之后通过 Send 发送消息、Recv 接收响应
+func (c *Client) NewStream(ctx context.Context, serviceMethod string, reply interface{}) (*ClientStream, error) {
+	return c.Stream(ctx, serviceMethod, nil, reply)
+}
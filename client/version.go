@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/yx-Anbf1a/anbrpc/discovery"
+)
+
+type versionKey struct{}
+
+// WithVersion 限定 DClient 调用的服务版本，按顺序选择，前面的版本没有可用实例时使用后面的版本
+// 空字符串表示任意实例，调用不带版本，由服务端选择最新版本，如 WithVersion(ctx, "v2", "v1", "")
+func WithVersion(ctx context.Context, versions ...string) context.Context {
+	return context.WithValue(ctx, versionKey{}, versions)
+}
+
+// routeVersions 返回去掉版本的方法名和依次尝试的版本
+// 方法名中直接写了版本时（FBoo@v2.Sum）只使用该版本，否则使用ctx中的版本，都没有时可以是任意实例
+func routeVersions(ctx context.Context, serviceMethod string) (string, []string) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot > 0 {
+		service, version := discovery.SplitVersion(serviceMethod[:dot])
+		if version != "" {
+			return service + serviceMethod[dot:], []string{version}
+		}
+	}
+	if versions, ok := ctx.Value(versionKey{}).([]string); ok && len(versions) > 0 {
+		return serviceMethod, versions
+	}
+	return serviceMethod, []string{""}
+}
+
+// versionedMethod FBoo.Sum 加上版本得到 FBoo@v2.Sum
+func versionedMethod(serviceMethod, version string) string {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if version == "" || dot < 0 {
+		return serviceMethod
+	}
+	return discovery.VersionedName(serviceMethod[:dot], version) + serviceMethod[dot:]
+}
@@ -20,12 +20,29 @@ type Codec interface {
 	//Encode(header *Header, body interface{}) error
 	//Decode() (header *Header, body []byte, err error)
 }
+
+// RawBodyCodec 支持先读取原始消息体、之后再解码的编解码器
+// 客户端流和双向流需要在不知道参数类型时先缓存消息，幂等响应需要保存编码后的消息
+type RawBodyCodec interface {
+	ReadRawBody(n int32) ([]byte, error)
+	Unmarshal(data []byte, body interface{}) error
+	Marshal(body interface{}) ([]byte, error)
+}
+
+// BodyLimiter 读取头部时就把消息体整体读入内存的编解码器，由服务端按方法设置请求体大小上限
+// 远超上限时停止读取并返回 ErrBodyTooLarge，连接随之关闭；limit返回0表示不限制
+type BodyLimiter interface {
+	SetBodyLimit(limit func(serviceMethod string) int32)
+}
+
 type Type string
 
 const (
 	GobType  Type = "application/gob"
 	JsonType Type = "application/json"
 	ProtoTyp Type = "proto"
+	// JSONRPCType 服务端识别出JSON-RPC 2.0请求时使用，客户端不能通过Option选择
+	JSONRPCType Type = "jsonrpc"
 )
 
 type NewCodecFunc func(io.ReadWriteCloser) Codec
@@ -49,6 +49,10 @@ func (c *GobCodec) Write(header *Header, body interface{}) (err error) {
 		log.Println("rpc codec: gob error encoding header: ", err)
 		return err
 	}
+	// 保活、取消等控制帧没有消息体，gob不能编码nil，以空结构体代替，读取方按 nil 丢弃
+	if body == nil {
+		body = struct{}{}
+	}
 	if err := c.enc.Encode(body); err != nil {
 		log.Println("rpc codec: gob error encoding body: ", err)
 		return err
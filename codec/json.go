@@ -3,38 +3,117 @@ package codec
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 )
 
 // // json 编解码器
 type JsonCodec struct {
-	conn io.ReadWriteCloser // conn
-	buf  *bufio.Writer      // 缓冲区
-	dec  *json.Decoder
-	enc  *json.Encoder
+	conn  io.ReadWriteCloser // conn
+	buf   *bufio.Writer      // 缓冲区
+	r     *limitReader       // 读取消息体时限制从conn读出的字节数
+	dec   *json.Decoder
+	enc   *json.Encoder
+	body  json.RawMessage                  // ReadHeader 读出的消息体
+	limit func(serviceMethod string) int32 // 请求体大小上限
 }
 
 var _ Codec = (*JsonCodec)(nil)
+var _ RawBodyCodec = (*JsonCodec)(nil)
+var _ BodyLimiter = (*JsonCodec)(nil)
+
+// ErrBodyTooLarge 消息体远超上限，停止读取，连接不能继续使用
+var ErrBodyTooLarge = errors.New("rpc codec: body too large")
+
+// bodyLimitSlack 超出上限不多的请求体仍然完整读出，由服务端回复错误后连接继续使用
+const bodyLimitSlack = 4 << 10
 
 func NewJsonCodec(conn io.ReadWriteCloser) Codec {
 	buf := bufio.NewWriter(conn)
-	dec := json.NewDecoder(conn)
+	r := &limitReader{r: conn, n: -1}
+	dec := json.NewDecoder(r)
 	enc := json.NewEncoder(buf)
 	return &JsonCodec{
 		conn: conn,
 		buf:  buf,
+		r:    r,
 		dec:  dec,
 		enc:  enc,
 	}
 }
 
+func (c *JsonCodec) SetBodyLimit(limit func(serviceMethod string) int32) {
+	c.limit = limit
+}
+
+// ReadHeader 同时读出紧随其后的消息体，以便在 Header.BodySize 中给出消息体大小
 func (c *JsonCodec) ReadHeader(header *Header) error {
-	return c.dec.Decode(header)
+	if err := c.dec.Decode(header); err != nil {
+		return err
+	}
+	c.body = nil
+	if c.limit != nil && header.Type == FrameType_UNARY && !header.Reverse {
+		if max := c.limit(header.ServiceMethod); max > 0 {
+			c.r.n = int64(max) + bodyLimitSlack
+			defer func() { c.r.n = -1 }()
+		}
+	}
+	if err := c.dec.Decode(&c.body); err != nil {
+		return err
+	}
+	header.BodySize = int32(len(c.body))
+	return nil
+}
+
+// limitReader n不小于0时最多再读出n字节，之后返回 ErrBodyTooLarge
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return l.r.Read(p)
+	}
+	if l.n == 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
 }
 
 func (c *JsonCodec) ReadBody(body interface{}, n int32) error {
-	return c.dec.Decode(body)
+	raw := c.body
+	c.body = nil
+	if body == nil {
+		// 丢弃消息体
+		return nil
+	}
+	// 消息体已经完整读出，解码失败不影响后续帧
+	if err := json.Unmarshal(raw, body); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
+	return nil
+}
+
+func (c *JsonCodec) ReadRawBody(n int32) ([]byte, error) {
+	raw := c.body
+	c.body = nil
+	return raw, nil
+}
+
+func (c *JsonCodec) Unmarshal(data []byte, body interface{}) error {
+	return json.Unmarshal(data, body)
+}
+
+func (c *JsonCodec) Marshal(body interface{}) ([]byte, error) {
+	return json.Marshal(body)
 }
 
 func (c *JsonCodec) Write(header *Header, body interface{}) (err error) {
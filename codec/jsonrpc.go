@@ -0,0 +1,301 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC 2.0 错误码
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCServerError    = -32000
+)
+
+// ErrInvalidBody 消息体无法解码为参数，但连接上的帧边界完好，回复错误后可以继续读取
+var ErrInvalidBody = errors.New("rpc codec: invalid body")
+
+// JSONRPCError JSON-RPC 2.0 的错误对象
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonrpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type jsonrpcResponse struct {
+	Version string           `json:"jsonrpc"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError    `json:"error,omitempty"`
+	ID      json.RawMessage  `json:"id"`
+}
+
+// jsonrpcBatch 一个批量请求，所有带id的请求都得到响应后一次写出
+type jsonrpcBatch struct {
+	remaining int
+	responses []*jsonrpcResponse
+}
+
+// jsonrpcCall 已读出、等待处理的请求
+type jsonrpcCall struct {
+	seq    uint64
+	method string
+	params json.RawMessage
+	oneWay bool
+}
+
+var jsonrpcNull = json.RawMessage("null")
+
+// JSONRPCCodec 服务端的 JSON-RPC 2.0 编解码器
+// 每个请求分配一个 Header.Seq，写响应时换回原来的id；没有id的通知作为单向调用，批量请求的响应合并成一个数组
+// 错误对象与 Header.Error 互相转换，只处理一元调用，其它帧直接丢弃
+type JSONRPCCodec struct {
+	conn io.ReadWriteCloser
+	dec  *json.Decoder
+	buf  *bufio.Writer
+
+	queue  []jsonrpcCall // 批量请求中还没有交给 ReadHeader 的请求
+	params json.RawMessage
+
+	mu      sync.Mutex // 读协程回复无效请求和处理协程写响应可能同时发生
+	seq     uint64
+	ids     map[uint64]json.RawMessage
+	batches map[uint64]*jsonrpcBatch
+}
+
+var _ Codec = (*JSONRPCCodec)(nil)
+var _ RawBodyCodec = (*JSONRPCCodec)(nil)
+
+func NewJSONRPCCodec(conn io.ReadWriteCloser) Codec {
+	return &JSONRPCCodec{
+		conn:    conn,
+		dec:     json.NewDecoder(conn),
+		buf:     bufio.NewWriter(conn),
+		ids:     make(map[uint64]json.RawMessage),
+		batches: make(map[uint64]*jsonrpcBatch),
+	}
+}
+
+func (c *JSONRPCCodec) ReadHeader(header *Header) error {
+	for len(c.queue) == 0 {
+		var raw json.RawMessage
+		if err := c.dec.Decode(&raw); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				// 无法继续定位下一个请求，回复后关闭连接
+				_ = c.writeResponse(jsonrpcErrorResponse(nil, JSONRPCParseError, "parse error"))
+			}
+			return err
+		}
+		if err := c.enqueue(raw); err != nil {
+			return err
+		}
+	}
+	call := c.queue[0]
+	c.queue = c.queue[1:]
+	header.ServiceMethod = call.method
+	header.Seq = call.seq
+	header.OneWay = call.oneWay
+	header.BodySize = int32(len(call.params))
+	c.params = call.params
+	return nil
+}
+
+// enqueue 拆分单个或批量请求，无效的请求直接回复错误
+func (c *JSONRPCCodec) enqueue(raw json.RawMessage) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '[' {
+		call, resp := c.parse(raw, nil)
+		if resp != nil {
+			return c.writeResponse(resp)
+		}
+		c.queue = append(c.queue, call)
+		return nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil || len(items) == 0 {
+		return c.writeResponse(jsonrpcErrorResponse(nil, JSONRPCInvalidRequest, "invalid request"))
+	}
+	batch := &jsonrpcBatch{}
+	for _, item := range items {
+		call, resp := c.parse(item, batch)
+		if resp != nil {
+			batch.responses = append(batch.responses, resp)
+			continue
+		}
+		c.queue = append(c.queue, call)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if batch.remaining == 0 {
+		return c.flushBatch(batch)
+	}
+	return nil
+}
+
+// parse 解析单个请求，无效时返回对应的错误响应
+func (c *JSONRPCCodec) parse(raw json.RawMessage, batch *jsonrpcBatch) (jsonrpcCall, *jsonrpcResponse) {
+	var req jsonrpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return jsonrpcCall{}, jsonrpcErrorResponse(nil, JSONRPCInvalidRequest, "invalid request")
+	}
+	if req.Version != "2.0" || req.Method == "" {
+		return jsonrpcCall{}, jsonrpcErrorResponse(req.ID, JSONRPCInvalidRequest, "invalid request")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	call := jsonrpcCall{seq: c.seq, method: req.Method, params: req.Params, oneWay: req.ID == nil}
+	if !call.oneWay {
+		c.ids[call.seq] = req.ID
+		if batch != nil {
+			batch.remaining++
+			c.batches[call.seq] = batch
+		}
+	}
+	return call, nil
+}
+
+// ReadBody 按名称传参时 params 就是参数，按位置传参时只接受一个参数
+func (c *JSONRPCCodec) ReadBody(body interface{}, n int32) error {
+	params := c.params
+	c.params = nil
+	if body == nil || len(params) == 0 {
+		return nil
+	}
+	if trimmed := bytes.TrimSpace(params); len(trimmed) > 0 && trimmed[0] == '[' {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(trimmed, &positional); err != nil || len(positional) != 1 {
+			return fmt.Errorf("%w: expect exactly one positional param", ErrInvalidBody)
+		}
+		params = positional[0]
+	}
+	if err := json.Unmarshal(params, body); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
+	return nil
+}
+
+func (c *JSONRPCCodec) ReadRawBody(n int32) ([]byte, error) {
+	params := c.params
+	c.params = nil
+	return params, nil
+}
+
+func (c *JSONRPCCodec) Unmarshal(data []byte, body interface{}) error {
+	return json.Unmarshal(data, body)
+}
+
+func (c *JSONRPCCodec) Marshal(body interface{}) ([]byte, error) {
+	return json.Marshal(body)
+}
+
+func (c *JSONRPCCodec) Write(header *Header, body interface{}) error {
+	if header.Type != FrameType_UNARY || header.Reverse {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.ids[header.Seq]
+	if !ok {
+		return nil
+	}
+	delete(c.ids, header.Seq)
+
+	var resp *jsonrpcResponse
+	if header.Error != "" {
+		resp = jsonrpcErrorResponse(id, jsonrpcErrorCode(header.Error), header.Error)
+	} else {
+		result, err := json.Marshal(body)
+		if err != nil {
+			resp = jsonrpcErrorResponse(id, JSONRPCServerError, "encode result: "+err.Error())
+		} else {
+			raw := json.RawMessage(result)
+			resp = &jsonrpcResponse{Version: "2.0", Result: &raw, ID: id}
+		}
+	}
+	batch, ok := c.batches[header.Seq]
+	if !ok {
+		return c.write(resp)
+	}
+	delete(c.batches, header.Seq)
+	batch.responses = append(batch.responses, resp)
+	batch.remaining--
+	if batch.remaining == 0 {
+		return c.flushBatch(batch)
+	}
+	return nil
+}
+
+// flushBatch 写出批量请求的响应，全是通知时不写，调用时持有c.mu
+func (c *JSONRPCCodec) flushBatch(batch *jsonrpcBatch) error {
+	if len(batch.responses) == 0 {
+		return nil
+	}
+	return c.write(batch.responses)
+}
+
+func (c *JSONRPCCodec) writeResponse(resp *jsonrpcResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.write(resp)
+}
+
+// write 每个响应或批量响应占一行，调用时持有c.mu
+func (c *JSONRPCCodec) write(v interface{}) (err error) {
+	defer func() {
+		_ = c.buf.Flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	return json.NewEncoder(c.buf).Encode(v)
+}
+
+func (c *JSONRPCCodec) Close() error {
+	return c.conn.Close()
+}
+
+func jsonrpcErrorResponse(id json.RawMessage, code int, msg string) *jsonrpcResponse {
+	if id == nil {
+		id = jsonrpcNull
+	}
+	return &jsonrpcResponse{Version: "2.0", Error: &JSONRPCError{Code: code, Message: msg}, ID: id}
+}
+
+// jsonrpcErrorCode 由 Header.Error 推断错误码
+func jsonrpcErrorCode(msg string) int {
+	switch {
+	case strings.Contains(msg, "can't find") || strings.Contains(msg, "ill-formed"):
+		return JSONRPCMethodNotFound
+	case strings.Contains(msg, ErrInvalidBody.Error()):
+		return JSONRPCInvalidParams
+	default:
+		return JSONRPCServerError
+	}
+}
+
+// IsJSONRPC 判断连接上第一个JSON值是否是 JSON-RPC 2.0 请求或批量请求
+func IsJSONRPC(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		return true
+	}
+	var probe struct {
+		Version string `json:"jsonrpc"`
+	}
+	return json.Unmarshal(raw, &probe) == nil && probe.Version != ""
+}
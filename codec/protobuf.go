@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"google.golang.org/protobuf/proto"
 	"io"
 )
@@ -16,6 +17,8 @@ type ProtocCodec struct {
 
 //var _ Codec = (*ProtocCodec)(nil)
 
+var _ RawBodyCodec = (*ProtocCodec)(nil)
+
 func NewProtoCodec(conn io.ReadWriteCloser) Codec {
 
 	buf := bufio.NewWriter(conn) // 为conn新增一个buf缓冲区
@@ -31,14 +34,18 @@ func (c *ProtocCodec) ReadHeader(header *Header) error {
 	// 反序列化
 	headerLenBuf := make([]byte, 4)
 	//_, _ = c.conn.Read(headerLenBuf)
-	_, _ = io.ReadFull(c.conn, headerLenBuf)
+	if _, err := io.ReadFull(c.conn, headerLenBuf); err != nil {
+		return err
+	}
 
 	headerLen := binary.BigEndian.Uint32(headerLenBuf)
 	//fmt.Printf("read headerLen: %d\n", headerLen)
 
 	headerBytes := make([]byte, headerLen)
 	//_, _ = c.conn.Read(headerBytes)
-	_, _ = io.ReadFull(c.conn, headerBytes)
+	if _, err := io.ReadFull(c.conn, headerBytes); err != nil {
+		return err
+	}
 
 	err := proto.Unmarshal(headerBytes, header)
 	return err
@@ -46,16 +53,49 @@ func (c *ProtocCodec) ReadHeader(header *Header) error {
 
 func (c *ProtocCodec) ReadBody(body interface{}, n int32) error {
 	// 反序列化
-	if body == nil || n == 0 {
-		return errors.New("nil body")
-		//return nil
+	if n == 0 {
+		return nil
+	}
+	// body为空时丢弃消息体，分块读出，不按对端声明的大小分配内存
+	if body == nil {
+		_, err := io.CopyN(io.Discard, c.conn, int64(n))
+		return err
 	}
 	buf := make([]byte, n)
-	_, _ = io.ReadFull(c.conn, buf)
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		return err
+	}
 	//_, _ = c.conn.Read(buf)
-	err := proto.Unmarshal(buf, body.(proto.Message))
+	// 消息体已经完整读出，解码失败不影响后续帧
+	if err := proto.Unmarshal(buf, body.(proto.Message)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
 	//fmt.Println("read body:", body)
-	return err
+	return nil
+}
+
+func (c *ProtocCodec) ReadRawBody(n int32) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (c *ProtocCodec) Unmarshal(data []byte, body interface{}) error {
+	m, ok := body.(proto.Message)
+	if !ok {
+		return errors.New("body is not a proto.Message")
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func (c *ProtocCodec) Marshal(body interface{}) ([]byte, error) {
+	m, ok := body.(proto.Message)
+	if !ok {
+		return nil, errors.New("body is not a proto.Message")
+	}
+	return proto.Marshal(m)
 }
 
 func (c *ProtocCodec) Write0(header *Header, body interface{}) (err error) {
@@ -88,8 +128,8 @@ func (c *ProtocCodec) Write(header *Header, body interface{}) (err error) {
 
 	// 序列化Header
 	var bodyBytes []byte
-	if body != nil {
-		bodyBytes, _ = proto.Marshal(body.(proto.Message))
+	if m, ok := body.(proto.Message); ok {
+		bodyBytes, _ = proto.Marshal(m)
 	} else {
 		bodyBytes = make([]byte, 0)
 	}
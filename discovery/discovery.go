@@ -11,9 +11,11 @@ import (
 )
 
 type Discovery interface {
-	Refresh() error                         // 从注册中心更新服务列表
-	Update(servers map[string]string) error // 手动更新
-	GetService() string                     // 根据负载均衡策略，选择一个服务实例
+	Refresh() error                          // 从注册中心更新服务列表
+	Update(servers map[string]string) error  // 手动更新
+	GetService() string                      // 根据负载均衡策略，选择一个服务实例
+	GetServiceVersion(version string) string // 只在注册了该版本的实例中选择，version为空时同 GetService
+	GetInstance(version string) Instance     // 同 GetServiceVersion，返回完整的实例信息，没有时Addr为空
 	GetAllService() []string
 	SetBalancer(balancer bl.Balancer)
 	WatchService(prefix string) error
@@ -120,22 +122,33 @@ func (s *ServerDiscovery) DelServiceList(key string) {
 
 // GetServices 获取服务地址
 func (s *ServerDiscovery) GetService() string {
+	return s.GetServiceVersion("")
+}
+
+// GetServiceVersion 按负载均衡策略选择一个注册了version的实例，没有时返回空
+func (s *ServerDiscovery) GetServiceVersion(version string) string {
+	return s.GetInstance(version).Addr
+}
+
+func (s *ServerDiscovery) GetInstance(version string) Instance {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	srvKey := make([]string, 0)
-	for k := range s.servers {
-		srvKey = append(srvKey, k)
+	for k, v := range s.servers {
+		if version == "" || ParseInstance(v).Version == version {
+			srvKey = append(srvKey, k)
+		}
 	}
 	key, _ := s.balancer.Pick(srvKey)
-	addr := s.servers[key]
-	return addr
+	return ParseInstance(s.servers[key])
 }
+
 func (s *ServerDiscovery) GetAllService() []string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	addrs := make([]string, 0)
 	for _, v := range s.servers {
-		addrs = append(addrs, v)
+		addrs = append(addrs, ParseInstance(v).Addr)
 	}
 	return addrs
 }
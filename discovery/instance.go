@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/yx-Anbf1a/anbrpc/option"
+)
+
+// VersionSeparator 服务名和版本之间的分隔符，如 FBoo@v2
+const VersionSeparator = "@"
+
+// Instance 注册中心中一个节点的值，格式为 protocol@addr，带版本时为 protocol@addr?version=v2
+// 设置了方法选项时以JSON放在 methods 参数中
+type Instance struct {
+	Addr    string // protocol@addr
+	Version string
+	Methods map[string]option.MethodOptions // 方法名 -> 注册时设置的选项
+}
+
+// ParseInstance 解析节点的值，没有参数的旧格式原样作为地址，无法解析的方法选项被忽略
+func ParseInstance(val string) Instance {
+	addr, query, ok := strings.Cut(val, "?")
+	if !ok {
+		return Instance{Addr: val}
+	}
+	q, _ := url.ParseQuery(query)
+	in := Instance{Addr: addr, Version: q.Get("version")}
+	if methods := q.Get("methods"); methods != "" {
+		_ = json.Unmarshal([]byte(methods), &in.Methods)
+	}
+	return in
+}
+
+func (in Instance) String() string {
+	q := url.Values{}
+	if in.Version != "" {
+		q.Set("version", in.Version)
+	}
+	if len(in.Methods) > 0 {
+		methods, _ := json.Marshal(in.Methods)
+		q.Set("methods", string(methods))
+	}
+	if len(q) == 0 {
+		return in.Addr
+	}
+	return in.Addr + "?" + q.Encode()
+}
+
+// MethodOptions 方法的选项，serviceMethod 为 Service.Method 形式时只取方法名
+func (in Instance) MethodOptions(serviceMethod string) option.MethodOptions {
+	return in.Methods[serviceMethod[strings.LastIndex(serviceMethod, ".")+1:]]
+}
+
+// SplitVersion 拆分 FBoo@v2 形式的服务名，没有版本时version为空
+func SplitVersion(name string) (service, version string) {
+	service, version, _ = strings.Cut(name, VersionSeparator)
+	return service, version
+}
+
+// VersionedName 带版本的服务名，version为空时就是service
+func VersionedName(service, version string) string {
+	if version == "" {
+		return service
+	}
+	return service + VersionSeparator + version
+}
+
+// CompareVersions 比较 v1.2.10 形式的版本，逐段按数字比较，不是数字的段按字符串比较
+func CompareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		if i >= len(as) {
+			return -1
+		}
+		if i >= len(bs) {
+			return 1
+		}
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case aerr == nil && berr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case (aerr != nil || berr != nil) && as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return 0
+}
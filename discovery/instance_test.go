@@ -0,0 +1,51 @@
+package discovery
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/option"
+)
+
+func TestInstance(t *testing.T) {
+	in := Instance{Addr: "tcp@127.0.0.1:9000", Version: "v2"}
+	if got := ParseInstance(in.String()); !reflect.DeepEqual(got, in) {
+		t.Fatalf("round trip: got %+v", got)
+	}
+	in.Methods = map[string]option.MethodOptions{"Sum": {Timeout: time.Second, Idempotent: true}}
+	got := ParseInstance(in.String())
+	if !reflect.DeepEqual(got, in) {
+		t.Fatalf("round trip with methods: got %+v", got)
+	}
+	if opts := got.MethodOptions("FBoo@v2.Sum"); opts.Timeout != time.Second || !opts.Idempotent {
+		t.Fatalf("method options: got %+v", opts)
+	}
+	if got := ParseInstance("tcp@127.0.0.1:9000"); got.Addr != "tcp@127.0.0.1:9000" || got.Version != "" {
+		t.Fatalf("unversioned: got %+v", got)
+	}
+	if service, version := SplitVersion("FBoo@v2"); service != "FBoo" || version != "v2" {
+		t.Fatalf("split: got %s %s", service, version)
+	}
+	if name := VersionedName("FBoo", ""); name != "FBoo" {
+		t.Fatalf("versioned name: got %s", name)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"v1", "v2", -1},
+		{"v10", "v9", 1},
+		{"v1.2", "v1.2", 0},
+		{"v1.2.1", "v1.2", 1},
+		{"v2-beta", "v2-alpha", 1},
+	}
+	for _, c := range cases {
+		if got := CompareVersions(c.a, c.b); got != c.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
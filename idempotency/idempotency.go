@@ -0,0 +1,109 @@
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/metadata"
+)
+
+// MetadataKey 存放幂等键的元数据key，同一个方法上相同幂等键的请求只执行一次
+const MetadataKey = "idempotency-key"
+
+// WithKey 为调用附带幂等键，重试时使用同一个键
+func WithKey(ctx context.Context, key string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, MetadataKey, key)
+}
+
+// Key 从请求元数据中取出幂等键
+func Key(md metadata.MD) string {
+	return md.Get(MetadataKey)
+}
+
+// Response 保存的响应，Body 是以 Codec 编码的响应体，与请求所用的连接编解码器无关
+type Response struct {
+	Codec codec.Type
+	Body  []byte
+}
+
+// Store 按方法保存幂等键对应的响应，实现需要并发安全
+type Store interface {
+	Get(serviceMethod, key string) (*Response, bool)
+	Put(serviceMethod, key string, resp *Response)
+}
+
+// MemoryStore 内存实现，每个方法最多保存 maxEntries 个响应，超过时淘汰最久未使用的，过期的响应视为不存在
+type MemoryStore struct {
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	methods map[string]*lru
+}
+
+type lru struct {
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key     string
+	resp    *Response
+	expires time.Time
+}
+
+func NewMemoryStore(maxEntries int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		methods:    make(map[string]*lru),
+	}
+}
+
+func (s *MemoryStore) Get(serviceMethod, key string) (*Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.methods[serviceMethod]
+	if c == nil {
+		return nil, false
+	}
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if s.now().After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.resp, true
+}
+
+func (s *MemoryStore) Put(serviceMethod, key string, resp *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.methods[serviceMethod]
+	if c == nil {
+		c = &lru{ll: list.New(), entries: make(map[string]*list.Element)}
+		s.methods[serviceMethod] = c
+	}
+	expires := s.now().Add(s.ttl)
+	if el, ok := c.entries[key]; ok {
+		el.Value = &entry{key: key, resp: resp, expires: expires}
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.ll.PushFront(&entry{key: key, resp: resp, expires: expires})
+	for s.maxEntries > 0 && c.ll.Len() > s.maxEntries {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.entries, el.Value.(*entry).key)
+	}
+}
@@ -0,0 +1,33 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(2, time.Minute)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	s.Put("Pay.Charge", "a", &Response{Body: []byte("1")})
+	s.Put("Pay.Charge", "b", &Response{Body: []byte("2")})
+	// 不同方法的相同键互不影响
+	s.Put("Pay.Refund", "a", &Response{Body: []byte("3")})
+	if resp, ok := s.Get("Pay.Charge", "a"); !ok || string(resp.Body) != "1" {
+		t.Fatalf("unexpected response %v %v", resp, ok)
+	}
+	// 超过容量淘汰最久未使用的 b
+	s.Put("Pay.Charge", "c", &Response{Body: []byte("4")})
+	if _, ok := s.Get("Pay.Charge", "b"); ok {
+		t.Fatal("expect b evicted")
+	}
+	if resp, ok := s.Get("Pay.Refund", "a"); !ok || string(resp.Body) != "3" {
+		t.Fatalf("unexpected response %v %v", resp, ok)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := s.Get("Pay.Charge", "a"); ok {
+		t.Fatal("expect a expired")
+	}
+}
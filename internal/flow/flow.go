@@ -0,0 +1,102 @@
+package flow
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrClosed = errors.New("flow: window closed")
+
+// Window 流的发送窗口，以消息条数计，额度用完后发送方阻塞直到对端归还
+type Window struct {
+	mu     sync.Mutex
+	avail  int
+	closed bool
+	notify chan struct{} // 额度增加或关闭时close并替换
+}
+
+func NewWindow(n int) *Window {
+	return &Window{avail: n, notify: make(chan struct{})}
+}
+
+// Acquire 占用一条消息的额度，done关闭时放弃等待
+func (w *Window) Acquire(done <-chan struct{}) error {
+	for {
+		w.mu.Lock()
+		if w.closed {
+			w.mu.Unlock()
+			return ErrClosed
+		}
+		if w.avail > 0 {
+			w.avail--
+			w.mu.Unlock()
+			return nil
+		}
+		notify := w.notify
+		w.mu.Unlock()
+		select {
+		case <-notify:
+		case <-done:
+			return ErrClosed
+		}
+	}
+}
+
+// Add 对端归还额度
+func (w *Window) Add(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.avail += n
+	close(w.notify)
+	w.notify = make(chan struct{})
+}
+
+func (w *Window) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.notify)
+}
+
+// Credit 接收端的额度统计，消费满半个窗口后归还给发送端
+type Credit struct {
+	mu          sync.Mutex
+	window      int
+	consumed    int
+	outstanding int // 已收到但还未归还额度的消息数
+}
+
+func NewCredit(window int) *Credit {
+	return &Credit{window: window}
+}
+
+// Consume 消费一条消息，返回需要归还的额度，0表示暂不归还
+func (c *Credit) Consume() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.consumed++
+	if c.consumed*2 < c.window {
+		return 0
+	}
+	n := c.consumed
+	c.consumed = 0
+	c.outstanding -= n
+	return n
+}
+
+// Receive 收到一条消息，发送端超出已授予的额度时返回false
+func (c *Credit) Receive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.outstanding >= c.window {
+		return false
+	}
+	c.outstanding++
+	return true
+}
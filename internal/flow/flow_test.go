@@ -0,0 +1,63 @@
+package flow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	w := NewWindow(2)
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		if err := w.Acquire(done); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acquired := make(chan error, 1)
+	go func() { acquired <- w.Acquire(done) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire should block when window is exhausted")
+	case <-time.After(20 * time.Millisecond):
+	}
+	w.Add(1)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	go func() { acquired <- w.Acquire(done) }()
+	close(done)
+	if err := <-acquired; err != ErrClosed {
+		t.Fatal("expect ErrClosed, got", err)
+	}
+	w.Close()
+	// 关闭后对端归还的额度被忽略
+	w.Add(1)
+}
+
+func TestCredit(t *testing.T) {
+	c := NewCredit(4)
+	if n := c.Consume(); n != 0 {
+		t.Fatal("expect 0, got", n)
+	}
+	if n := c.Consume(); n != 2 {
+		t.Fatal("expect 2, got", n)
+	}
+}
+
+func TestCreditReceive(t *testing.T) {
+	c := NewCredit(2)
+	for i := 0; i < 2; i++ {
+		if !c.Receive() {
+			t.Fatal("receive within window should succeed")
+		}
+	}
+	if c.Receive() {
+		t.Fatal("receive beyond window should fail")
+	}
+	if n := c.Consume(); n != 1 {
+		t.Fatal("expect 1, got", n)
+	}
+	if !c.Receive() {
+		t.Fatal("receive after credit returned should succeed")
+	}
+}
@@ -0,0 +1,118 @@
+package keepalive
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/option"
+)
+
+// Keepalive 连接两端共用的保活和空闲检测
+// 连接上超过 Interval 没有收到任何帧时发送PING，之后 Timeout 内仍没有收到任何帧则认为对端已断开；
+// 超过 Idle 没有请求且没有未完成的请求时关闭连接
+type Keepalive struct {
+	params option.KeepaliveParams
+	ping   func() error        // 发送PING帧，失败时等待超时关闭
+	close  func(reason string) // 关闭连接
+	busy   func() bool         // 是否有未完成的请求
+
+	lastRead   int64 // 最后一次收到帧的时间
+	lastActive int64 // 最后一次请求活动的时间
+	pingSent   int64 // 未得到回应的PING的发送时间，0表示没有
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func New(params option.KeepaliveParams, ping func() error, close func(reason string), busy func() bool) *Keepalive {
+	now := time.Now().UnixNano()
+	return &Keepalive{
+		params:     params,
+		ping:       ping,
+		close:      close,
+		busy:       busy,
+		lastRead:   now,
+		lastActive: now,
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start 开始检测，两项都未开启时什么也不做
+func (k *Keepalive) Start() {
+	tick := k.tick()
+	if tick == 0 {
+		return
+	}
+	go k.run(tick)
+}
+
+func (k *Keepalive) Stop() {
+	k.stopOnce.Do(func() { close(k.stop) })
+}
+
+// Read 收到一帧，active表示是请求或响应而不是PING/PONG
+func (k *Keepalive) Read(active bool) {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&k.lastRead, now)
+	atomic.StoreInt64(&k.pingSent, 0)
+	if active {
+		atomic.StoreInt64(&k.lastActive, now)
+	}
+}
+
+// Activity 请求完成，重新开始计算空闲时间
+func (k *Keepalive) Activity() {
+	atomic.StoreInt64(&k.lastActive, time.Now().UnixNano())
+}
+
+// tick 检测周期，取各项时间中最短的四分之一
+func (k *Keepalive) tick() time.Duration {
+	var tick time.Duration
+	for _, d := range []time.Duration{k.params.Interval, k.params.Timeout, k.params.Idle} {
+		if d > 0 && (tick == 0 || d < tick) {
+			tick = d
+		}
+	}
+	if k.params.Interval <= 0 && k.params.Idle <= 0 {
+		return 0
+	}
+	return tick / 4
+}
+
+func (k *Keepalive) run(tick time.Duration) {
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	for {
+		select {
+		case <-k.stop:
+			return
+		case now := <-t.C:
+			if reason := k.check(now); reason != "" {
+				k.close(reason)
+				return
+			}
+		}
+	}
+}
+
+// check 返回需要关闭连接的原因，空表示连接正常
+func (k *Keepalive) check(now time.Time) string {
+	if k.params.Idle > 0 && !k.busy() && now.Sub(time.Unix(0, atomic.LoadInt64(&k.lastActive))) >= k.params.Idle {
+		return "idle timeout"
+	}
+	if k.params.Interval <= 0 {
+		return ""
+	}
+	if sent := atomic.LoadInt64(&k.pingSent); sent != 0 {
+		if k.params.Timeout > 0 && now.Sub(time.Unix(0, sent)) >= k.params.Timeout {
+			return "keepalive timeout"
+		}
+		return ""
+	}
+	if now.Sub(time.Unix(0, atomic.LoadInt64(&k.lastRead))) >= k.params.Interval {
+		atomic.StoreInt64(&k.pingSent, now.UnixNano())
+		// 对端不读取时写入可能一直阻塞，异步发送，由超时检测关闭连接
+		go func() { _ = k.ping() }()
+	}
+	return ""
+}
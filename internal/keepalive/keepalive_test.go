@@ -0,0 +1,75 @@
+package keepalive
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/option"
+)
+
+func TestKeepalive_Timeout(t *testing.T) {
+	var pings int32
+	closed := make(chan string, 1)
+	k := New(option.KeepaliveParams{Interval: 20 * time.Millisecond, Timeout: 40 * time.Millisecond},
+		func() error { atomic.AddInt32(&pings, 1); return nil },
+		func(reason string) { closed <- reason },
+		func() bool { return false })
+	k.Start()
+	defer k.Stop()
+
+	// 对端一直回复，连接保持
+	deadline := time.Now().Add(150 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if atomic.LoadInt32(&pings) > 0 {
+			k.Read(false)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case reason := <-closed:
+		t.Fatalf("unexpected close: %s", reason)
+	default:
+	}
+	if atomic.LoadInt32(&pings) == 0 {
+		t.Fatal("expect pings")
+	}
+
+	// 对端不再回复
+	select {
+	case reason := <-closed:
+		if reason != "keepalive timeout" {
+			t.Fatalf("unexpected reason %s", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect close after timeout")
+	}
+}
+
+func TestKeepalive_Idle(t *testing.T) {
+	var busy int32 = 1
+	closed := make(chan string, 1)
+	k := New(option.KeepaliveParams{Idle: 40 * time.Millisecond},
+		func() error { return nil },
+		func(reason string) { closed <- reason },
+		func() bool { return atomic.LoadInt32(&busy) == 1 })
+	k.Start()
+	defer k.Stop()
+
+	// 有未完成的请求时不关闭
+	select {
+	case reason := <-closed:
+		t.Fatalf("unexpected close: %s", reason)
+	case <-time.After(100 * time.Millisecond):
+	}
+	atomic.StoreInt32(&busy, 0)
+	k.Activity()
+	select {
+	case reason := <-closed:
+		if reason != "idle timeout" {
+			t.Fatalf("unexpected reason %s", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect idle close")
+	}
+}
@@ -40,6 +40,44 @@ func InitLogger(fileName, mode string) (lg *zap.Logger, err error) {
 	return lg, nil
 }
 
+// 日志输出格式
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Config 日志配置
+type Config struct {
+	Path   string        // 日志文件路径，为空时输出到标准错误
+	Level  zapcore.Level // 最低日志级别
+	Format string        // FormatJSON 或 FormatConsole，为空时写文件用JSON、标准错误用console
+}
+
+// New 按配置创建Logger，不替换zap的全局Logger
+func New(cfg Config) (*zap.Logger, error) {
+	format := cfg.Format
+	if format == "" {
+		format = FormatJSON
+		if cfg.Path == "" {
+			format = FormatConsole
+		}
+	}
+	var encoder zapcore.Encoder
+	switch format {
+	case FormatJSON:
+		encoder = getEncoder()
+	case FormatConsole:
+		encoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	default:
+		return nil, fmt.Errorf("logger: unknown format %q", cfg.Format)
+	}
+	writeSyncer := zapcore.Lock(os.Stderr)
+	if cfg.Path != "" {
+		writeSyncer = getLogWriter(cfg.Path, 200, 30, 7)
+	}
+	return zap.New(zapcore.NewCore(encoder, writeSyncer, cfg.Level), zap.AddCaller()), nil
+}
+
 func getEncoder() zapcore.Encoder {
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -59,3 +97,31 @@ func getLogWriter(filename string, maxSize, maxBackup, maxAge int) zapcore.Write
 	}
 	return zapcore.AddSync(lumberJackLogger)
 }
+
+// WithLevel 返回以level为最低级别的Logger，可以低于lg本身的级别，用于单独调整某个方法的日志
+func WithLevel(lg *zap.Logger, level zapcore.Level) *zap.Logger {
+	return lg.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &levelCore{Core: c, level: level}
+	}))
+}
+
+// levelCore 用自己的级别替换被包装的Core的级别
+type levelCore struct {
+	zapcore.Core
+	level zapcore.Level
+}
+
+func (c *levelCore) Enabled(l zapcore.Level) bool {
+	return c.level.Enabled(l)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
@@ -0,0 +1,127 @@
+package memconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// Network 内存连接的网络名，服务地址写作 mem@name
+const Network = "mem"
+
+var (
+	// ErrAddrInUse 同名的Listener已经存在
+	ErrAddrInUse = errors.New("memconn: address already in use")
+	// ErrConnRefused 没有同名的Listener，或者Listener已经关闭
+	ErrConnRefused = errors.New("memconn: connection refused")
+)
+
+var (
+	mu        sync.Mutex
+	listeners = make(map[string]*Listener)
+)
+
+// Addr 内存连接的地址
+type Addr string
+
+func (a Addr) Network() string { return Network }
+func (a Addr) String() string  { return string(a) }
+
+// Listener 进程内的监听器，Dial得到的连接不经过网络，关闭后Accept返回 net.ErrClosed
+type Listener struct {
+	name  string
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// Listen 以name监听，同一进程内可以通过 Dial(name) 连接；name为空时不登记，只能通过 Listener.Dial 连接
+func Listen(name string) (*Listener, error) {
+	l := &Listener{name: name, conns: make(chan net.Conn), done: make(chan struct{})}
+	if name == "" {
+		return l, nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := listeners[name]; ok {
+		return nil, ErrAddrInUse
+	}
+	listeners[name] = l
+	return l, nil
+}
+
+// Dial 连接同一进程内以name监听的Listener
+func Dial(name string) (net.Conn, error) {
+	return DialContext(context.Background(), name)
+}
+
+func DialContext(ctx context.Context, name string) (net.Conn, error) {
+	mu.Lock()
+	l := listeners[name]
+	mu.Unlock()
+	if l == nil {
+		return nil, ErrConnRefused
+	}
+	return l.DialContext(ctx)
+}
+
+func (l *Listener) Dial() (net.Conn, error) {
+	return l.DialContext(context.Background())
+}
+
+// DialContext 等待Accept取走连接，ctx结束或Listener关闭时返回错误
+func (l *Listener) DialContext(ctx context.Context) (net.Conn, error) {
+	cli, srv := net.Pipe()
+	select {
+	case l.conns <- &conn{Conn: srv, local: l.Addr(), remote: Addr(l.name + "-client")}:
+		return &conn{Conn: cli, local: Addr(l.name + "-client"), remote: l.Addr()}, nil
+	case <-l.done:
+	case <-ctx.Done():
+	}
+	_ = cli.Close()
+	_ = srv.Close()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, ErrConnRefused
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+		if l.name == "" {
+			return
+		}
+		mu.Lock()
+		if listeners[l.name] == l {
+			delete(listeners, l.name)
+		}
+		mu.Unlock()
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return Addr(l.name)
+}
+
+// conn net.Pipe 的地址都是 pipe，换成Listener的名字
+type conn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
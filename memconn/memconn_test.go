@@ -0,0 +1,75 @@
+package memconn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListener(t *testing.T) {
+	l, err := Listen("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Listen("svc"); err != ErrAddrInUse {
+		t.Fatalf("expect ErrAddrInUse, got %v", err)
+	}
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_, _ = io.Copy(c, c)
+	}()
+	c, err := Dial("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RemoteAddr().Network() != Network || c.RemoteAddr().String() != "svc" {
+		t.Fatalf("unexpected remote addr %v", c.RemoteAddr())
+	}
+	if _, err = c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(c, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("expect echo, got %q %v", buf, err)
+	}
+	_ = c.Close()
+
+	_ = l.Close()
+	if _, err = l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expect net.ErrClosed, got %v", err)
+	}
+	if _, err = Dial("svc"); err != ErrConnRefused {
+		t.Fatalf("expect ErrConnRefused, got %v", err)
+	}
+	// 关闭后名字可以重新使用
+	l, err = Listen("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = l.Close()
+}
+
+func TestDialContext(t *testing.T) {
+	l, err := Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// 没有Accept时等待到ctx结束
+	if _, err = l.DialContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+	if _, err = Dial(""); err != ErrConnRefused {
+		t.Fatalf("anonymous listener should not be registered, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"context"
+	"strings"
+)
+
+// MD 请求元数据，随 codec.Header 一起发送
+type MD map[string]string
+
+// New 由键值对创建元数据，键统一转为小写
+func New(kv map[string]string) MD {
+	md := make(MD, len(kv))
+	for k, v := range kv {
+		md[strings.ToLower(k)] = v
+	}
+	return md
+}
+
+// Pairs 由 k1, v1, k2, v2... 创建元数据
+func Pairs(kv ...string) MD {
+	if len(kv)%2 == 1 {
+		panic("metadata: Pairs got the odd number of input pairs")
+	}
+	md := make(MD, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md[strings.ToLower(kv[i])] = kv[i+1]
+	}
+	return md
+}
+
+func (md MD) Get(k string) string {
+	return md[strings.ToLower(k)]
+}
+
+func (md MD) Set(k, v string) {
+	md[strings.ToLower(k)] = v
+}
+
+func (md MD) Copy() MD {
+	out := make(MD, len(md))
+	for k, v := range md {
+		out[k] = v
+	}
+	return out
+}
+
+// Join 合并多个元数据，后面的覆盖前面的
+func Join(mds ...MD) MD {
+	out := MD{}
+	for _, md := range mds {
+		for k, v := range md {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+type outgoingKey struct{}
+type incomingKey struct{}
+
+// NewOutgoingContext 客户端：把元数据挂到ctx上，Call时发送
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+// AppendToOutgoingContext 客户端：在已有的元数据上追加键值对
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	return NewOutgoingContext(ctx, Join(md, Pairs(kv...)))
+}
+
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md, ok
+}
+
+// NewIncomingContext 服务端：把收到的元数据挂到ctx上
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md, ok
+}
@@ -0,0 +1,18 @@
+package option
+
+import "time"
+
+// MethodOptions 注册服务时为单个方法设置的选项，零值表示使用默认行为
+// 通过反射服务和注册中心公开，客户端可以据此设置相同的超时和重试策略
+type MethodOptions struct {
+	Timeout        time.Duration `json:"timeout,omitempty"`          // 处理超时，覆盖连接的 HandleTimeOut
+	MaxRequestSize int32         `json:"max_request_size,omitempty"` // 请求体的最大字节数，编解码器无法得知大小时（gob）不检查
+	Idempotent     bool          `json:"idempotent,omitempty"`       // 方法是幂等的，客户端可以安全地重试
+	MaxConcurrency int           `json:"max_concurrency,omitempty"`  // 同时处理的最大请求数，超过时直接返回错误
+	LogLevel       string        `json:"log_level,omitempty"`        // 该方法的访问日志和请求错误日志的级别，如 debug，为空时使用Server的级别
+}
+
+// IsZero 没有设置任何选项
+func (o MethodOptions) IsZero() bool {
+	return o == MethodOptions{}
+}
@@ -7,9 +7,13 @@ import (
 )
 
 const (
-	Connected        = "200 Connected to Gee RPC"
-	DefaultRPCPath   = "/_geeprc_"
-	DefaultDebugPath = "/debug/geerpc"
+	Connected            = "200 Connected to Gee RPC"
+	DefaultRPCPath       = "/_geeprc_"
+	DefaultWebSocketPath = "/_geeprc_ws_"
+	DefaultDebugPath     = "/debug/geerpc"
+	DefaultMetricsPath   = "/metrics"
+	DefaultGatewayPath   = "/rpc"
+	DefaultJSONRPCPath   = "/jsonrpc"
 )
 
 type Option struct {
@@ -17,6 +21,20 @@ type Option struct {
 	CodecType      codec.Type    // 编码类型
 	ConnectTimeOut time.Duration // 连接超时时间
 	HandleTimeOut  time.Duration // 处理超时时间
+	StreamWindow   int           // 每个流的流控窗口(消息条数)，两个方向相同
+	Keepalive      KeepaliveParams
+}
+
+// KeepaliveParams 连接保活和空闲关闭策略，客户端通过 Option 设置，服务端通过 Server.WithKeepalive 设置
+type KeepaliveParams struct {
+	Interval time.Duration // 连接上多久没有收到数据时发送PING，0表示不发送
+	Timeout  time.Duration // 发送PING后多久仍没有收到数据时关闭连接
+	Idle     time.Duration // 多久没有请求时关闭连接，0表示不关闭
+}
+
+var DefaultKeepalive = KeepaliveParams{
+	Interval: time.Second * 30,
+	Timeout:  time.Second * 10,
 }
 
 var DefaultOption = &Option{
@@ -24,6 +42,8 @@ var DefaultOption = &Option{
 	CodecType:      codec.ProtoTyp,
 	ConnectTimeOut: time.Second * 10,
 	HandleTimeOut:  time.Second * 10,
+	StreamWindow:   64,
+	Keepalive:      DefaultKeepalive,
 }
 
 func ParseOption(opts ...*Option) (*Option, error) {
@@ -39,5 +59,11 @@ func ParseOption(opts ...*Option) (*Option, error) {
 	if opt.CodecType == "" {
 		opt.CodecType = DefaultOption.CodecType
 	}
+	if opt.StreamWindow <= 0 {
+		opt.StreamWindow = DefaultOption.StreamWindow
+	}
+	if opt.Keepalive.Interval > 0 && opt.Keepalive.Timeout <= 0 {
+		opt.Keepalive.Timeout = DefaultKeepalive.Timeout
+	}
 	return opt, nil
 }
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/tracing"
+	"go.uber.org/zap"
+)
+
+// RequestIDKey 调用方传入请求ID的元数据key，写入访问日志
+const RequestIDKey = "x-request-id"
+
+// AccessLogConfig 访问日志配置，每个处理完成的请求输出一行，方法设置了 LogLevel 时按其级别输出
+type AccessLogConfig struct {
+	SampleRate    float64       // 记录的比例，0到1，1表示全部记录
+	SlowThreshold time.Duration // 耗时达到该值的请求不受采样限制，总是以Warn级别记录，0表示不区分慢请求
+}
+
+// WithAccessLog 开启访问日志，如 WithAccessLog(AccessLogConfig{SampleRate: 0.1, SlowThreshold: time.Second})
+func (s *Server) WithAccessLog(cfg AccessLogConfig) {
+	s.accessLog = &cfg
+}
+
+// finishRequest 请求处理完成，记录指标和访问日志，并按方法的日志级别输出
+func (s *Server) finishRequest(req *request, status string, start time.Time, respBytes int32) {
+	serviceMethod, latency := req.h.ServiceMethod, time.Since(start)
+	s.metrics.end(req.metricsMethod(), status, latency, req.reqBytes, respBytes)
+	if req.mtype != nil {
+		req.mtype.logger.Debug("rpc server: request done", zap.String("method", serviceMethod), zap.String("status", status), zap.Duration("latency", latency))
+	}
+	if s.accessLog != nil {
+		s.logAccess(req, status, latency, respBytes)
+	}
+}
+
+func (s *Server) logAccess(req *request, status string, latency time.Duration, respBytes int32) {
+	cfg := s.accessLog
+	slow := cfg.SlowThreshold > 0 && latency >= cfg.SlowThreshold
+	if !slow && (cfg.SampleRate <= 0 || (cfg.SampleRate < 1 && rand.Float64() >= cfg.SampleRate)) {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("method", req.h.ServiceMethod),
+		zap.Uint64("seq", req.h.Seq),
+		zap.String("status", status),
+		zap.Duration("latency", latency),
+		zap.Int32("req_bytes", req.reqBytes),
+		zap.Int32("resp_bytes", respBytes),
+	}
+	if p := req.peer; p != nil {
+		fields = append(fields, zap.String("peer", p.Addr), zap.Uint64("conn_id", p.ConnID))
+		if p.Identity != nil {
+			fields = append(fields, zap.String("principal", p.Identity.Principal))
+		}
+	}
+	if sc := req.traceContext(); sc.IsValid() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID.String()), zap.String("span_id", sc.SpanID.String()))
+	}
+	if id := req.md.Get(RequestIDKey); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if req.h.Error != "" {
+		fields = append(fields, zap.String("error", req.h.Error))
+	}
+	lg := s.requestLogger(req)
+	if slow {
+		lg.Warn("rpc access: slow request", fields...)
+		return
+	}
+	lg.Info("rpc access", fields...)
+}
+
+// traceContext 请求的服务端span，没有开启追踪时是调用方传入的trace
+func (req *request) traceContext() tracing.SpanContext {
+	if req.span != nil {
+		if sc := req.span.SpanContext(); sc.IsValid() {
+			return sc
+		}
+	}
+	sc, _ := tracing.Extract(req.md)
+	return sc
+}
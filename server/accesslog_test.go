@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/metadata"
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+	"github.com/yx-Anbf1a/anbrpc/tracing"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Napper 处理方法耗时固定，用于测试慢请求
+type Napper struct{}
+
+func (n *Napper) Nap(args *test_service.FBooArgs) *test_service.FBooReply {
+	time.Sleep(50 * time.Millisecond)
+	return &test_service.FBooReply{}
+}
+
+func newAccessLogServer(t *testing.T, cfg AccessLogConfig) (*Server, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	s := newServer(zap.New(core))
+	for _, rcvr := range []interface{}{&test_service.FBoo{}, &Napper{}} {
+		if _, err := s._register(rcvr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.WithAccessLog(cfg)
+	return s, logs
+}
+
+func TestServer_AccessLog(t *testing.T) {
+	s, logs := newAccessLogServer(t, AccessLogConfig{SampleRate: 1})
+	c := dialTestServer(t, s)
+
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDKey, "req-1", tracing.TraceparentKey, tp)
+	var reply test_service.FBooReply
+	_ = c.Call(context.Background(), "FBoo.Missing", &test_service.FBooArgs{}, &reply)
+	if err := c.Call(ctx, "FBoo.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	waitIdle(t, s, "FBoo.Sum")
+
+	entries := logs.FilterMessage("rpc access").All()
+	_assert(len(entries) == 2, "expect 2 access logs, got %d", len(entries))
+	// 找不到方法的请求在执行前被拒绝，同样记录
+	rejected := entries[0].ContextMap()
+	_assert(rejected["method"] == "FBoo.Missing" && rejected["status"] == statusError && rejected["error"] != nil, "unexpected rejected fields %v", rejected)
+	st := s.metrics.stats(unknownMethod)
+	_assert(st.calls == 1 && st.errors == 1 && st.inFlight == 0, "unexpected unknown method stats %+v", st)
+	fields := entries[1].ContextMap()
+	_assert(fields["method"] == "FBoo.Sum" && fields["status"] == statusOK, "unexpected fields %v", fields)
+	_assert(fields["seq"] != uint64(0) && fields["conn_id"] != uint64(0) && fields["peer"] == "pipe", "unexpected peer fields %v", fields)
+	_assert(fields["request_id"] == "req-1" && fields["trace_id"] == "4bf92f3577b34da6a3ce929d0e0e4736", "unexpected ids %v", fields)
+	_assert(fields["req_bytes"].(int32) > 0 && fields["resp_bytes"].(int32) > 0, "unexpected sizes %v", fields)
+	_assert(fields["latency"] != nil, "missing latency")
+}
+
+func TestServer_AccessLogSlow(t *testing.T) {
+	// 不采样时只记录慢请求
+	s, logs := newAccessLogServer(t, AccessLogConfig{SlowThreshold: 20 * time.Millisecond})
+	c := dialTestServer(t, s)
+	var reply test_service.FBooReply
+	for _, method := range []string{"FBoo.Sum", "Napper.Nap"} {
+		if err := c.Call(context.Background(), method, &test_service.FBooArgs{}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		waitIdle(t, s, method)
+	}
+	_assert(logs.FilterMessage("rpc access").Len() == 0, "expect no sampled access log")
+	slow := logs.FilterMessage("rpc access: slow request").All()
+	_assert(len(slow) == 1 && slow[0].Level == zapcore.WarnLevel, "expect 1 slow warning, got %d", len(slow))
+	_assert(slow[0].ContextMap()["method"] == "Napper.Nap", "unexpected slow request %v", slow[0].ContextMap())
+}
+
+func TestServer_AccessLogMethodLevel(t *testing.T) {
+	s, logs := newAccessLogServer(t, AccessLogConfig{SampleRate: 1})
+	// 方法的日志级别同样作用于访问日志
+	err := s.RegisterName("Quiet", &test_service.FBoo{}, RegisterConfig{Methods: map[string]option.MethodOptions{"Sum": {LogLevel: "error"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := dialTestServer(t, s)
+	var reply test_service.FBooReply
+	for _, method := range []string{"Quiet.Sum", "FBoo.Sum"} {
+		if err = c.Call(context.Background(), method, &test_service.FBooArgs{}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		waitIdle(t, s, method)
+	}
+	entries := logs.FilterMessage("rpc access").All()
+	_assert(len(entries) == 1 && entries[0].ContextMap()["method"] == "FBoo.Sum", "expect only FBoo.Sum logged, got %v", entries)
+}
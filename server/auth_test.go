@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/auth"
+	"github.com/yx-Anbf1a/anbrpc/client"
+	"github.com/yx-Anbf1a/anbrpc/metadata"
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+	"go.uber.org/zap"
+)
+
+// newTestServer 不监听端口、不写日志文件的Server
+func newTestServer(t *testing.T, rcvrs ...interface{}) *Server {
+	s := newServer(zap.NewNop())
+	for _, rcvr := range rcvrs {
+		if _, err := s._register(rcvr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// dialTestServer 通过内存管道连接到Server
+func dialTestServer(t *testing.T, s *Server, opts ...*option.Option) *client.Client {
+	cliConn, srvConn := net.Pipe()
+	go s.serveConn(srvConn)
+	c, err := client.Dial(cliConn, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestServer_Authorize(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	s.WithAuth(auth.NewTokenAuthenticator(map[string]*auth.Identity{
+		"alice-token": {Principal: "alice", Roles: []string{"admin"}},
+		"bob-token":   {Principal: "bob"},
+	}), auth.NewAuthorizer(&auth.Policy{
+		DefaultDeny: true,
+		Rules: []auth.Rule{
+			{Method: "FBoo.Sum", Allow: auth.Subjects{Roles: []string{"admin"}}},
+		},
+	}))
+
+	alice := dialTestServer(t, s)
+	alice.WithCredentials(client.BearerToken("alice-token"))
+	var reply test_service.FBooReply
+	if err := alice.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 3, "expect 3, got %d", reply.Num)
+
+	bob := dialTestServer(t, s)
+	bob.WithCredentials(client.BearerToken("bob-token"))
+	err := bob.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), auth.ErrPermissionDenied.Error()), "expect permission denied, got %v", err)
+	_assert(s.mustMethod("FBoo.Sum").NumsCalls() == 1, "denied call must not run the method")
+
+	// 拒绝后连接仍然可用
+	err = alice.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{Num1: 2, Num2: 2}, &reply)
+	_assert(err == nil && reply.Num == 4, "expect 4, got %d, %v", reply.Num, err)
+}
+
+// MDReader 把请求元数据 x-num 作为结果返回
+type MDReader struct{}
+
+func (r *MDReader) Num(ctx context.Context, args *test_service.FBooArgs) *test_service.FBooReply {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var reply test_service.FBooReply
+	if md.Get("x-num") == "7" {
+		reply.Num = 7
+	}
+	return &reply
+}
+
+func TestServer_IncomingMetadata(t *testing.T) {
+	s := newTestServer(t, &MDReader{})
+	c := dialTestServer(t, s)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-num", "7")
+	var reply test_service.FBooReply
+	if err := c.Call(ctx, "MDReader.Num", &test_service.FBooArgs{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 7, "handler did not see request metadata, got %d", reply.Num)
+
+	// 不经过连接的请求，HTTP头作为元数据
+	r := httptest.NewRequest(http.MethodPost, "/rpc/MDReader/Num", strings.NewReader(`{}`))
+	r.Header.Set("X-Num", "7")
+	w := httptest.NewRecorder()
+	s.GatewayHandler("").ServeHTTP(w, r)
+	_assert(w.Code == http.StatusOK && strings.Contains(w.Body.String(), "7"), "unexpected gateway response %d %s", w.Code, w.Body)
+}
+
+func TestServer_MalformedCredentials(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	s.WithAuth(auth.NewTokenAuthenticator(map[string]*auth.Identity{"alice-token": {Principal: "alice"}}), nil)
+	c := dialTestServer(t, s)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), auth.AuthorizationKey, "alice-token")
+	var reply test_service.FBooReply
+	err := c.Call(ctx, "FBoo.Sum", &test_service.FBooArgs{Num1: 1}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), auth.ErrUnauthenticated.Error()), "expect unauthenticated, got %v", err)
+}
+
+func (s *Server) mustMethod(serviceMethod string) *MethodType {
+	_, mtype, err := s.findService(serviceMethod)
+	if err != nil {
+		panic(err)
+	}
+	return mtype
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+)
+
+// ErrCallbackClosed 连接已经断开，无法再反向调用客户端
+var ErrCallbackClosed = errors.New("rpc server: callback connection closed")
+
+// Callback 通过客户端的连接反向调用客户端上注册的服务
+// 反向调用的请求和响应都带 Reverse 标记，使用独立的序列号，与客户端发起的调用互不影响
+// 可以在处理方法返回后保存下来，用于推送通知，连接断开后调用返回 ErrCallbackClosed
+type Callback struct {
+	cc      codec.Codec
+	sending *sync.Mutex
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]*reverseCall
+	closed  bool
+}
+
+type reverseCall struct {
+	reply interface{}
+	done  chan error
+}
+
+type callbackKey struct{}
+
+func newCallback(cc codec.Codec, sending *sync.Mutex) *Callback {
+	return &Callback{cc: cc, sending: sending, pending: make(map[uint64]*reverseCall)}
+}
+
+// CallbackFromContext 在处理方法中获取调用方连接的 Callback，JSON-RPC连接无法反向调用，没有 Callback
+func CallbackFromContext(ctx context.Context) (*Callback, bool) {
+	cb, ok := ctx.Value(callbackKey{}).(*Callback)
+	return cb, ok
+}
+
+// Call 调用客户端的 Service.Method，等待响应或ctx结束
+func (cb *Callback) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	call := &reverseCall{reply: reply, done: make(chan error, 1)}
+	cb.mu.Lock()
+	if cb.closed {
+		cb.mu.Unlock()
+		return ErrCallbackClosed
+	}
+	cb.seq++
+	seq := cb.seq
+	cb.pending[seq] = call
+	cb.mu.Unlock()
+
+	h := &codec.Header{ServiceMethod: serviceMethod, Seq: seq, Reverse: true}
+	cb.sending.Lock()
+	err := cb.cc.Write(h, args)
+	cb.sending.Unlock()
+	if err != nil {
+		cb.remove(seq)
+		return errors.New("rpc server: writing callback: " + err.Error())
+	}
+	select {
+	case <-ctx.Done():
+		cb.remove(seq)
+		return errors.New("rpc server: callback failed " + ctx.Err().Error())
+	case err = <-call.done:
+		return err
+	}
+}
+
+func (cb *Callback) remove(seq uint64) *reverseCall {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	call := cb.pending[seq]
+	delete(cb.pending, seq)
+	return call
+}
+
+// deliver 连接的读协程收到客户端的响应
+func (cb *Callback) deliver(h *codec.Header, raw []byte) {
+	call := cb.remove(h.Seq)
+	if call == nil {
+		return
+	}
+	if h.Error != "" {
+		call.done <- errors.New(h.Error)
+		return
+	}
+	rc, ok := cb.cc.(codec.RawBodyCodec)
+	if !ok {
+		call.done <- errRawBodyUnsupported
+		return
+	}
+	call.done <- rc.Unmarshal(raw, call.reply)
+}
+
+// close 连接断开，结束所有未完成的反向调用
+func (cb *Callback) close() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.closed = true
+	for seq, call := range cb.pending {
+		call.done <- ErrCallbackClosed
+		delete(cb.pending, seq)
+	}
+}
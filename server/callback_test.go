@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+// Doubler 注册在客户端上，供服务端反向调用
+type Doubler struct{}
+
+func (d *Doubler) Double(args *test_service.FBooArgs) *test_service.FBooReply {
+	return &test_service.FBooReply{Num: args.Num1 * 2}
+}
+
+// Relay 处理请求时反向调用客户端
+type Relay struct{}
+
+func (r *Relay) Double(ctx context.Context, args *test_service.FBooArgs) *test_service.FBooReply {
+	cb, ok := CallbackFromContext(ctx)
+	if !ok {
+		return &test_service.FBooReply{Num: -1}
+	}
+	var reply test_service.FBooReply
+	if err := cb.Call(ctx, "Doubler.Double", args, &reply); err != nil {
+		return &test_service.FBooReply{Num: -2}
+	}
+	return &test_service.FBooReply{Num: reply.Num + 1}
+}
+
+func (r *Relay) Missing(ctx context.Context, args *test_service.FBooArgs) *test_service.FBooReply {
+	cb, _ := CallbackFromContext(ctx)
+	var reply test_service.FBooReply
+	if err := cb.Call(ctx, "Doubler.Missing", args, &reply); err != nil {
+		return &test_service.FBooReply{Num: -2}
+	}
+	return &reply
+}
+
+// Malformed 反向调用时发送客户端无法解码的参数
+func (r *Relay) Malformed(ctx context.Context, args *test_service.FBooArgs) *test_service.FBooReply {
+	cb, _ := CallbackFromContext(ctx)
+	var reply test_service.FBooReply
+	if err := cb.Call(ctx, "Doubler.Double", "malformed", &reply); err != nil {
+		return &test_service.FBooReply{Num: -2}
+	}
+	return &reply
+}
+
+func TestCallback(t *testing.T) {
+	s := newTestServer(t, &Relay{})
+	c := dialTestServer(t, s)
+	if err := c.Register(&Doubler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个方向的调用并发进行，序列号互不干扰
+	var wg sync.WaitGroup
+	for i := int32(1); i <= 10; i++ {
+		wg.Add(1)
+		go func(i int32) {
+			defer wg.Done()
+			var reply test_service.FBooReply
+			if err := c.Call(context.Background(), "Relay.Double", &test_service.FBooArgs{Num1: i}, &reply); err != nil {
+				t.Error(err)
+				return
+			}
+			if reply.Num != i*2+1 {
+				t.Errorf("expect %d, got %d", i*2+1, reply.Num)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var reply test_service.FBooReply
+	if err := c.Call(context.Background(), "Relay.Missing", &test_service.FBooArgs{Num1: 1}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == -2, "expect callback error for missing method, got %d", reply.Num)
+}
+
+func TestCallback_MalformedArgs(t *testing.T) {
+	s := newTestServer(t, &Relay{})
+	c := dialTestServer(t, s, &option.Option{CodecType: codec.JsonType})
+	if err := c.Register(&Doubler{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var reply test_service.FBooReply
+	if err := c.Call(ctx, "Relay.Malformed", &test_service.FBooArgs{Num1: 1}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == -2, "expect callback error for malformed args, got %d", reply.Num)
+
+	// 客户端只回复这次反向调用失败，连接仍然可用
+	if err := c.Call(ctx, "Relay.Double", &test_service.FBooArgs{Num1: 3}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 7, "expect 7, got %d", reply.Num)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+// Sleeper 一直等到请求被取消
+type Sleeper struct {
+	canceled chan error
+}
+
+func (s *Sleeper) Wait(ctx context.Context, args *test_service.FBooArgs) *test_service.FBooReply {
+	<-ctx.Done()
+	s.canceled <- ctx.Err()
+	return &test_service.FBooReply{}
+}
+
+// waitIdle 等待方法的所有请求处理完成
+func waitIdle(t *testing.T, s *Server, serviceMethod string) {
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&s.metrics.method(serviceMethod).inFlight) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s still in flight", serviceMethod)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServer_CancelCall(t *testing.T) {
+	sleeper := &Sleeper{canceled: make(chan error, 1)}
+	s := newTestServer(t, sleeper, &Counter{})
+	_assert(s.mustMethod("Sleeper.Wait").withContext, "Wait should take a context")
+	c := dialTestServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var reply test_service.FBooReply
+	err := c.Call(ctx, "Sleeper.Wait", &test_service.FBooArgs{}, &reply)
+	_assert(err != nil, "expect call error after ctx timeout")
+
+	select {
+	case err = <-sleeper.canceled:
+		_assert(err == context.Canceled, "expect handler ctx canceled, got %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("handler ctx not canceled")
+	}
+	waitIdle(t, s, "Sleeper.Wait")
+	st := s.metrics.method("Sleeper.Wait")
+	st.mu.Lock()
+	_assert(st.statuses[statusCanceled] == 1, "expect canceled status, got %v", st.statuses)
+	st.mu.Unlock()
+
+	// 连接仍然可用
+	if err = c.Call(context.Background(), "Counter.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 3, "unexpected reply %v", reply.Num)
+}
+
+func TestServer_CancelStream(t *testing.T) {
+	f := &Flood{}
+	s := newTestServer(t, f)
+	c := dialTestServer(t, s, &option.Option{StreamWindow: 4})
+
+	stream, err := c.Stream(context.Background(), "Flood.Flood", &test_service.FBooArgs{Num1: 100}, (*test_service.FBooReply)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	// 服务端阻塞在发送窗口上，关闭后应当结束处理方法
+	_ = stream.Close()
+	waitIdle(t, s, "Flood.Flood")
+	_assert(atomic.LoadInt32(&f.sent) < 100, "stream should stop early, sent %d", atomic.LoadInt32(&f.sent))
+}
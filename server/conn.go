@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/internal/keepalive"
+)
+
+// countingConn 统计连接上的读写字节数
+type countingConn struct {
+	io.ReadWriteCloser
+	read    uint64
+	written uint64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	atomic.AddUint64(&c.read, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddUint64(&c.written, uint64(n))
+	return n, err
+}
+
+// inflightCall 正在处理的请求
+type inflightCall struct {
+	seq           uint64
+	serviceMethod string
+	start         time.Time
+	cancel        context.CancelFunc // 取消处理方法的context
+}
+
+// connInfo 一条存活连接的信息
+type connInfo struct {
+	id    uint64
+	peer  string
+	start time.Time
+	rw    *countingConn
+
+	mu       sync.Mutex
+	codec    codec.Type
+	inflight map[uint64]*inflightCall
+	streams  map[uint64]*ServerStream // 连接上打开的流 seq -> stream
+
+	keepalive *keepalive.Keepalive
+}
+
+var connID uint64
+
+func newConnInfo(conn io.ReadWriteCloser) *connInfo {
+	ci := &connInfo{
+		id:       atomic.AddUint64(&connID, 1),
+		start:    time.Now(),
+		rw:       &countingConn{ReadWriteCloser: conn},
+		inflight: make(map[uint64]*inflightCall),
+		streams:  make(map[uint64]*ServerStream),
+	}
+	if nc, ok := conn.(net.Conn); ok {
+		ci.peer = nc.RemoteAddr().String()
+	}
+	return ci
+}
+
+func (ci *connInfo) setCodec(t codec.Type) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	ci.codec = t
+}
+
+func (ci *connInfo) begin(seq uint64, serviceMethod string, cancel context.CancelFunc) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	ci.inflight[seq] = &inflightCall{seq: seq, serviceMethod: serviceMethod, start: time.Now(), cancel: cancel}
+}
+
+func (ci *connInfo) end(seq uint64) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	delete(ci.inflight, seq)
+	if ci.keepalive != nil {
+		ci.keepalive.Activity()
+	}
+}
+
+// busy 是否有未完成的请求
+func (ci *connInfo) busy() bool {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	return len(ci.inflight) > 0
+}
+
+func (ci *connInfo) addStream(ss *ServerStream) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	ci.streams[ss.seq] = ss
+}
+
+func (ci *connInfo) removeStream(seq uint64) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	delete(ci.streams, seq)
+}
+
+// cancel 取消请求，请求已经结束时忽略
+func (ci *connInfo) cancel(seq uint64) {
+	ci.mu.Lock()
+	call := ci.inflight[seq]
+	ci.mu.Unlock()
+	if call != nil {
+		call.cancel()
+	}
+}
+
+// dispatchFrame 把客户端发来的流帧交给对应的流，流已结束时丢弃
+func (ci *connInfo) dispatchFrame(h *codec.Header, raw []byte) {
+	if h.Type == codec.FrameType_CANCEL {
+		ci.cancel(h.Seq)
+		return
+	}
+	ci.mu.Lock()
+	ss := ci.streams[h.Seq]
+	ci.mu.Unlock()
+	if ss == nil {
+		return
+	}
+	switch h.Type {
+	case codec.FrameType_STREAM_DATA:
+		ss.pushRecv(raw)
+	case codec.FrameType_STREAM_END:
+		ss.closeRecv(io.EOF)
+	case codec.FrameType_STREAM_ERROR:
+		ss.closeRecv(errors.New(h.Error))
+	case codec.FrameType_WINDOW_UPDATE:
+		ss.window.Add(int(h.Window))
+	}
+}
+
+// cancelAll 连接断开时取消所有请求，包括流
+func (ci *connInfo) cancelAll() {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	for _, call := range ci.inflight {
+		call.cancel()
+	}
+}
+
+// trackConn 记录存活连接，返回的函数在连接关闭时调用
+func (s *Server) trackConn(ci *connInfo) func() {
+	s.conns.Store(ci.id, ci)
+	return func() {
+		s.conns.Delete(ci.id)
+	}
+}
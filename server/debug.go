@@ -1,28 +1,52 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
 )
 
 const debugText = `<html>
 	<body>
 	<title>GeeRPC Services</title>
-	{{range .}}
+	{{range .Services}}
 	<hr>
-	Service {{.ServiceName}}
+	Service {{.Name}}
 	<hr>
 		<table>
-		<th align=center>Method</th><th align=center>Calls</th>
-		{{range $name, $mtype := .Method}}
+		<th align=center>Method</th><th align=center>Calls</th><th align=center>Errors</th><th align=center>In-flight</th><th align=center>Avg latency</th>
+		{{range .Methods}}
 			<tr>
-			<td align=left font=fixed>{{$name}}({{$mtype.ArgType}}, {{$mtype.ReplyType}}) error</td>
-			<td align=center>{{$mtype.NumCalls}}</td>
+			<td align=left font=fixed>{{.Name}}({{.ArgType}}) {{.ReplyType}}</td>
+			<td align=center>{{.Calls}}</td>
+			<td align=center>{{.Errors}}</td>
+			<td align=center>{{.InFlight}}</td>
+			<td align=center>{{.AvgLatencyMs}}ms</td>
 			</tr>
 		{{end}}
 		</table>
 	{{end}}
+	<hr>
+	Connections
+	<hr>
+		<table>
+		<th align=center>ID</th><th align=center>Peer</th><th align=center>Codec</th><th align=center>Age</th><th align=center>Bytes read</th><th align=center>Bytes written</th><th align=center>In-flight</th>
+		{{range .Connections}}
+			<tr>
+			<td align=center>{{.ID}}</td>
+			<td align=left>{{.Peer}}</td>
+			<td align=left>{{.Codec}}</td>
+			<td align=right>{{.AgeMs}}ms</td>
+			<td align=right>{{.BytesRead}}</td>
+			<td align=right>{{.BytesWritten}}</td>
+			<td align=left>{{range .InFlight}}#{{.Seq}} {{.ServiceMethod}} {{.ElapsedMs}}ms<br>{{end}}</td>
+			</tr>
+		{{end}}
+		</table>
 	</body>
 	</html>`
 
@@ -32,25 +56,110 @@ type debugHTTP struct {
 	*Server
 }
 
+type debugInfo struct {
+	Services    []debugService `json:"services"`
+	Connections []debugConn    `json:"connections"`
+}
+
 type debugService struct {
-	Name   string
-	Method map[string]*MethodType
+	Name    string        `json:"name"`
+	Methods []debugMethod `json:"methods"`
+}
+
+type debugMethod struct {
+	Name         string  `json:"name"`
+	ArgType      string  `json:"arg_type"`
+	ReplyType    string  `json:"reply_type"`
+	Calls        uint64  `json:"calls"`
+	Errors       uint64  `json:"errors"`
+	InFlight     int64   `json:"in_flight"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+type debugConn struct {
+	ID           uint64      `json:"id"`
+	Peer         string      `json:"peer"`
+	Codec        string      `json:"codec"`
+	AgeMs        int64       `json:"age_ms"`
+	BytesRead    uint64      `json:"bytes_read"`
+	BytesWritten uint64      `json:"bytes_written"`
+	InFlight     []debugCall `json:"in_flight"`
+}
+
+type debugCall struct {
+	Seq           uint64 `json:"seq"`
+	ServiceMethod string `json:"service_method"`
+	ElapsedMs     int64  `json:"elapsed_ms"`
 }
 
-// Runs at /debug/geerpc
+// Runs at /debug/geerpc, ?format=json 返回JSON
 func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// Build a sorted version of the data.
-	var services []debugService
-	server.ServiceMap.Range(func(namei, svci interface{}) bool {
+	info := server.debugInfo()
+	if req.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(info)
+		return
+	}
+	err := debug.Execute(w, info)
+	if err != nil {
+		_, _ = fmt.Fprintln(w, "rpc: error executing template:", err.Error())
+	}
+}
+
+// debugInfo 收集服务、方法统计和存活连接
+func (s *Server) debugInfo() *debugInfo {
+	now := time.Now()
+	info := &debugInfo{}
+	s.ServiceMap.Range(func(namei, svci interface{}) bool {
 		svc := svci.(*Service)
-		services = append(services, debugService{
-			Name:   namei.(string),
-			Method: svc.GetMethods(),
+		ds := debugService{Name: namei.(string)}
+		for _, name := range sortedMethodNames(svc) {
+			m := svc.method[name]
+			st := s.metrics.stats(namei.(string) + "." + name)
+			ds.Methods = append(ds.Methods, debugMethod{
+				Name:         name,
+				ArgType:      m.ArgType.String(),
+				ReplyType:    m.ReplyType.String(),
+				Calls:        st.calls,
+				Errors:       st.errors,
+				InFlight:     st.inFlight,
+				AvgLatencyMs: float64(st.avgLatency.Microseconds()) / 1000,
+			})
+		}
+		info.Services = append(info.Services, ds)
+		return true
+	})
+	sort.Slice(info.Services, func(i, j int) bool {
+		return info.Services[i].Name < info.Services[j].Name
+	})
+
+	s.conns.Range(func(_, v interface{}) bool {
+		ci := v.(*connInfo)
+		ci.mu.Lock()
+		dc := debugConn{
+			ID:           ci.id,
+			Peer:         ci.peer,
+			Codec:        string(ci.codec),
+			AgeMs:        now.Sub(ci.start).Milliseconds(),
+			BytesRead:    atomic.LoadUint64(&ci.rw.read),
+			BytesWritten: atomic.LoadUint64(&ci.rw.written),
+		}
+		for _, call := range ci.inflight {
+			dc.InFlight = append(dc.InFlight, debugCall{
+				Seq:           call.seq,
+				ServiceMethod: call.serviceMethod,
+				ElapsedMs:     now.Sub(call.start).Milliseconds(),
+			})
+		}
+		ci.mu.Unlock()
+		sort.Slice(dc.InFlight, func(i, j int) bool {
+			return dc.InFlight[i].Seq < dc.InFlight[j].Seq
 		})
+		info.Connections = append(info.Connections, dc)
 		return true
 	})
-	err := debug.Execute(w, services)
-	if err != nil {
-		_, _ = fmt.Fprintln(w, "rpc: error executing template:", err.Error())
-	}
+	sort.Slice(info.Connections, func(i, j int) bool {
+		return info.Connections[i].ID < info.Connections[j].ID
+	})
+	return info
 }
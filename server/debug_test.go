@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+func TestDebugHTTP(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	c := dialTestServer(t, s)
+	var reply test_service.FBooReply
+	if err := c.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	call := c.Go("FBoo.Sleep", &test_service.FBooArgs{}, &test_service.FBooReply{}, nil)
+	time.Sleep(100 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	debugHTTP{s}.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/geerpc", nil))
+	html := rec.Body.String()
+	_assert(!strings.Contains(html, "error executing template"), "template error: %s", html)
+	_assert(strings.Contains(html, "FBoo.Sleep"), "in-flight call missing: %s", html)
+
+	rec = httptest.NewRecorder()
+	debugHTTP{s}.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/geerpc?format=json", nil))
+	var info debugInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	_assert(len(info.Connections) == 1, "expect 1 connection, got %v", info.Connections)
+	conn := info.Connections[0]
+	_assert(conn.Codec == "proto" && conn.BytesRead > 0 && conn.BytesWritten > 0, "unexpected conn %+v", conn)
+	_assert(len(conn.InFlight) == 1 && conn.InFlight[0].ServiceMethod == "FBoo.Sleep", "unexpected in-flight %+v", conn.InFlight)
+	for _, svc := range info.Services {
+		if svc.Name != "FBoo" {
+			continue
+		}
+		for _, m := range svc.Methods {
+			if m.Name == "Sum" {
+				_assert(m.Calls == 1 && m.Errors == 0, "unexpected stats %+v", m)
+			}
+			if m.Name == "Sleep" {
+				_assert(m.InFlight == 1, "unexpected stats %+v", m)
+			}
+		}
+	}
+	<-call.Done
+}
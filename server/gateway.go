@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxGatewayBody 网关请求体的大小上限
+const maxGatewayBody = 4 << 20
+
+type gatewayHTTP struct {
+	*Server
+	prefix string
+}
+
+// HandleGateway 在 prefix 下注册HTTP/JSON网关，prefix为空时使用 option.DefaultGatewayPath
+// POST {prefix}/{Service}/{Method} 的请求体按JSON解码为方法参数，proto消息使用protojson，响应同样编码为JSON
+func (s *Server) HandleGateway(prefix string) {
+	h := s.GatewayHandler(prefix)
+	http.Handle(h.(gatewayHTTP).prefix+"/", h)
+	s.logger.Info("rpc server gateway path", zap.String("prefix", h.(gatewayHTTP).prefix))
+}
+
+// GatewayHandler 返回HTTP/JSON网关的Handler，可挂到自定义的ServeMux上
+func (s *Server) GatewayHandler(prefix string) http.Handler {
+	if prefix == "" {
+		prefix = option.DefaultGatewayPath
+	}
+	return gatewayHTTP{Server: s, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// ServeHTTP 与连接上的请求走同样的认证授权和指标统计，HTTP头作为请求元数据；流式方法不支持
+func (server gatewayHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGatewayError(w, http.StatusMethodNotAllowed, "rpc gateway: must POST")
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, server.prefix+"/")
+	slash := strings.LastIndex(path, "/")
+	if path == r.URL.Path || slash <= 0 || slash == len(path)-1 {
+		writeGatewayError(w, http.StatusNotFound, "rpc gateway: path must be "+server.prefix+"/{Service}/{Method}")
+		return
+	}
+	serviceMethod := path[:slash] + "." + path[slash+1:]
+	svc, mtype, err := server.findService(serviceMethod)
+	if err != nil {
+		writeGatewayError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if mtype.ServerStreaming {
+		writeGatewayError(w, http.StatusNotImplemented, "rpc gateway: stream method "+serviceMethod+" is not supported")
+		return
+	}
+
+	req := newDirectRequest(serviceMethod, svc, mtype, r, codec.JsonType)
+
+	start, status := time.Now(), statusOK
+	var respBytes int32
+	server.metrics.begin(req.metricsMethod())
+	defer func() {
+		server.finishRequest(req, status, start, respBytes)
+	}()
+
+	if err = server.authorize(req); err != nil {
+		status = authStatus(err)
+		code := http.StatusForbidden
+		if status == statusUnauthenticated {
+			code = http.StatusUnauthorized
+		}
+		respBytes = writeGatewayError(w, code, err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGatewayBody+1))
+	if err == nil && len(body) > maxGatewayBody {
+		err = errors.New("request body too large")
+	}
+	req.reqBytes = int32(len(body))
+	if err == nil {
+		if err = mtype.checkSize(req.reqBytes); err != nil {
+			status = statusError
+			respBytes = writeGatewayError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+	}
+	if err == nil && len(body) > 0 {
+		err = unmarshalJSON(body, argPointer(req.argv))
+	}
+	if err != nil {
+		status = statusError
+		respBytes = writeGatewayError(w, http.StatusBadRequest, "rpc gateway: decode request: "+err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	if timeout := mtype.timeout(option.DefaultOption.HandleTimeOut); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	status, err = server.callDirect(ctx, req)
+	switch status {
+	case statusOK:
+	case statusCanceled:
+		// 调用方断开了连接，不再响应
+		return
+	case statusDeadlineExceeded:
+		respBytes = writeGatewayError(w, http.StatusGatewayTimeout, err.Error())
+		return
+	case statusResourceExhausted:
+		respBytes = writeGatewayError(w, http.StatusTooManyRequests, err.Error())
+		return
+	default:
+		respBytes = writeGatewayError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out, err := marshalJSON(req.replyv.Interface())
+	if err != nil {
+		status = statusError
+		respBytes = writeGatewayError(w, http.StatusInternalServerError, "rpc gateway: encode response: "+err.Error())
+		return
+	}
+	respBytes = writeGatewayJSON(w, http.StatusOK, out)
+}
+
+// argPointer 参数为值类型时取其地址，解码需要指针
+func argPointer(argv reflect.Value) interface{} {
+	if argv.Kind() != reflect.Ptr {
+		return argv.Addr().Interface()
+	}
+	return argv.Interface()
+}
+
+func unmarshalJSON(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return protojson.Unmarshal(data, m)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func marshalJSON(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return protojson.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+func writeGatewayJSON(w http.ResponseWriter, code int, body []byte) int32 {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+	return int32(len(body))
+}
+
+// writeGatewayError 错误响应的格式为 {"error": "..."}
+func writeGatewayError(w http.ResponseWriter, code int, msg string) int32 {
+	body, _ := json.Marshal(map[string]string{"error": msg})
+	return writeGatewayJSON(w, code, body)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/auth"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+type GreetArgs struct {
+	Name string `json:"name"`
+}
+
+type GreetReply struct {
+	Message string `json:"message"`
+}
+
+type Greeter struct{}
+
+func (g *Greeter) Hello(args *GreetArgs) *GreetReply {
+	return &GreetReply{Message: "hello " + args.Name}
+}
+
+func gatewayPost(t *testing.T, h http.Handler, path, body string, header http.Header) (int, map[string]interface{}) {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	_assert(w.Header().Get("Content-Type") == "application/json", "unexpected content type %q", w.Header().Get("Content-Type"))
+	var out map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return w.Code, out
+}
+
+func TestGateway(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo, &Greeter{})
+	h := s.GatewayHandler("/rpc/")
+
+	code, out := gatewayPost(t, h, "/rpc/FBoo/Sum", `{"Num1": 1, "Num2": 2}`, nil)
+	_assert(code == http.StatusOK, "expect 200, got %d", code)
+	_assert(out["Num"] == float64(3), "expect Num 3, got %v", out)
+
+	code, out = gatewayPost(t, h, "/rpc/Greeter/Hello", `{"name": "anb"}`, nil)
+	_assert(code == http.StatusOK, "expect 200, got %d", code)
+	_assert(out["message"] == "hello anb", "unexpected reply %v", out)
+
+	code, _ = gatewayPost(t, h, "/rpc/FBoo/Missing", `{}`, nil)
+	_assert(code == http.StatusNotFound, "expect 404, got %d", code)
+	code, _ = gatewayPost(t, h, "/rpc/FBoo", `{}`, nil)
+	_assert(code == http.StatusNotFound, "expect 404, got %d", code)
+	code, out = gatewayPost(t, h, "/rpc/FBoo/Sum", `{"Num1": "x"}`, nil)
+	_assert(code == http.StatusBadRequest, "expect 400, got %d", code)
+	_assert(out["error"] != nil, "expect error message, got %v", out)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rpc/FBoo/Sum", nil))
+	_assert(w.Code == http.StatusMethodNotAllowed, "expect 405, got %d", w.Code)
+
+	st := s.metrics.stats("FBoo.Sum")
+	_assert(st.calls == 2, "expect 2 calls, got %d", st.calls)
+	_assert(st.errors == 1, "expect 1 error, got %d", st.errors)
+}
+
+func TestGateway_Auth(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	s.WithAuth(auth.NewTokenAuthenticator(map[string]*auth.Identity{
+		"alice-token": {Principal: "alice", Roles: []string{"admin"}},
+		"bob-token":   {Principal: "bob"},
+	}), auth.NewAuthorizer(&auth.Policy{
+		DefaultDeny: true,
+		Rules: []auth.Rule{
+			{Method: "FBoo.Sum", Allow: auth.Subjects{Roles: []string{"admin"}}},
+		},
+	}))
+	h := s.GatewayHandler("")
+
+	code, _ := gatewayPost(t, h, "/rpc/FBoo/Sum", `{"Num1": 1}`, http.Header{"Authorization": {"Bearer bad"}})
+	_assert(code == http.StatusUnauthorized, "expect 401, got %d", code)
+	code, _ = gatewayPost(t, h, "/rpc/FBoo/Sum", `{"Num1": 1}`, http.Header{"Authorization": {"Bearer bob-token"}})
+	_assert(code == http.StatusForbidden, "expect 403, got %d", code)
+	code, out := gatewayPost(t, h, "/rpc/FBoo/Sum", `{"Num1": 1}`, http.Header{"Authorization": {"Bearer alice-token"}})
+	_assert(code == http.StatusOK, "expect 200, got %d", code)
+	_assert(out["Num"] == float64(1), "expect Num 1, got %v", out)
+}
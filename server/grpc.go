@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+)
+
+// gRPC状态码
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcUnknown           = 2
+	grpcDeadlineExceeded  = 4
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnauthenticated   = 16
+)
+
+// maxGRPCMessage 单个gRPC请求消息的大小上限
+const maxGRPCMessage = 4 << 20
+
+// grpcStatus 请求状态对应的gRPC状态码
+var grpcStatus = map[string]int{
+	statusOK:                grpcOK,
+	statusError:             grpcUnknown,
+	statusUnauthenticated:   grpcUnauthenticated,
+	statusPermissionDenied:  grpcPermissionDenied,
+	statusDeadlineExceeded:  grpcDeadlineExceeded,
+	statusCanceled:          grpcCanceled,
+	statusResourceExhausted: grpcResourceExhausted,
+}
+
+type grpcHTTP struct {
+	*Server
+}
+
+// GRPCHandler 返回兼容gRPC的h2c Handler，gRPC客户端可以直接调用参数和响应都是proto消息的一元方法
+// 路径 /pkg.Service/Method 先按 pkg.Service 查找服务，找不到时去掉包名再查找；流式方法返回 Unimplemented
+func (s *Server) GRPCHandler() http.Handler {
+	return h2c.NewHandler(grpcHTTP{s}, &http2.Server{})
+}
+
+// ServeGRPC 在lis上以h2c方式接受gRPC请求，直到lis关闭
+func (s *Server) ServeGRPC(lis net.Listener) error {
+	return (&http.Server{Handler: s.GRPCHandler()}).Serve(lis)
+}
+
+func (server grpcHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, "rpc grpc: HTTP/2 required", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "rpc grpc: must POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/grpc" && ct != "application/grpc+proto" {
+		http.Error(w, "rpc grpc: unsupported content type "+ct, http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+
+	svc, mtype, serviceMethod, ok := server.findGRPCMethod(r.URL.Path)
+	if !ok {
+		writeGRPCStatus(w, grpcUnimplemented, "rpc grpc: unknown method "+r.URL.Path)
+		return
+	}
+	if mtype.ServerStreaming {
+		writeGRPCStatus(w, grpcUnimplemented, "rpc grpc: stream method "+serviceMethod+" is not supported")
+		return
+	}
+	if !mtype.ArgType.Implements(protoMessageType) || !mtype.ReplyType.Implements(protoMessageType) {
+		writeGRPCStatus(w, grpcUnimplemented, "rpc grpc: "+serviceMethod+" args and reply must be proto messages")
+		return
+	}
+
+	req := newDirectRequest(serviceMethod, svc, mtype, r, codec.ProtoTyp)
+	start, status := time.Now(), statusOK
+	var respBytes int32
+	server.metrics.begin(req.metricsMethod())
+	defer func() {
+		server.finishRequest(req, status, start, respBytes)
+	}()
+
+	if err := server.authorize(req); err != nil {
+		status = authStatus(err)
+		writeGRPCStatus(w, grpcStatus[status], err.Error())
+		return
+	}
+	body, code, err := readGRPCMessage(r.Body)
+	req.reqBytes = int32(len(body))
+	if err == nil {
+		if err = mtype.checkSize(req.reqBytes); err != nil {
+			code = grpcResourceExhausted
+		}
+	}
+	if err == nil {
+		err = proto.Unmarshal(body, req.argv.Interface().(proto.Message))
+	}
+	if err != nil {
+		status = statusError
+		writeGRPCStatus(w, code, "rpc grpc: decode request: "+err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	if timeout := mtype.timeout(option.DefaultOption.HandleTimeOut); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if timeout, ok := parseGRPCTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+	status, err = server.callDirect(ctx, req)
+	if err != nil {
+		writeGRPCStatus(w, grpcStatus[status], err.Error())
+		return
+	}
+	out, err := proto.Marshal(req.replyv.Interface().(proto.Message))
+	if err != nil {
+		status = statusError
+		writeGRPCStatus(w, grpcInternal, "rpc grpc: encode response: "+err.Error())
+		return
+	}
+	// 长度前缀：1字节压缩标记 + 4字节消息长度
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(out)))
+	_, _ = w.Write(prefix)
+	_, _ = w.Write(out)
+	respBytes = int32(len(out))
+	writeGRPCStatus(w, grpcOK, "")
+}
+
+// findGRPCMethod 按 /pkg.Service/Method 查找方法
+func (s *Server) findGRPCMethod(path string) (*Service, *MethodType, string, bool) {
+	path = strings.TrimPrefix(path, "/")
+	slash := strings.LastIndex(path, "/")
+	if slash <= 0 || slash == len(path)-1 {
+		return nil, nil, "", false
+	}
+	service, method := path[:slash], path[slash+1:]
+	if svc, mtype, err := s.findService(service + "." + method); err == nil {
+		return svc, mtype, service + "." + method, true
+	}
+	if dot := strings.LastIndex(service, "."); dot >= 0 {
+		serviceMethod := service[dot+1:] + "." + method
+		if svc, mtype, err := s.findService(serviceMethod); err == nil {
+			return svc, mtype, serviceMethod, true
+		}
+	}
+	return nil, nil, "", false
+}
+
+// readGRPCMessage 读取一条带长度前缀的消息，失败时同时返回对应的gRPC状态码
+func readGRPCMessage(r io.Reader) ([]byte, int, error) {
+	prefix := make([]byte, 5)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, grpcInternal, err
+	}
+	if prefix[0] != 0 {
+		return nil, grpcUnimplemented, fmt.Errorf("compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > maxGRPCMessage {
+		return nil, grpcResourceExhausted, fmt.Errorf("message size %d exceeds limit %d", n, maxGRPCMessage)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, grpcInternal, err
+	}
+	return body, grpcOK, nil
+}
+
+// parseGRPCTimeout 解析 grpc-timeout 头，如 100m 表示100毫秒
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[v[len(v)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// writeGRPCStatus 以trailer发送状态码和错误信息
+func writeGRPCStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeGRPCMessage(msg))
+	}
+}
+
+// encodeGRPCMessage grpc-message 中可打印ASCII以外的字节和 % 需要百分号编码
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
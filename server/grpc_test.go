@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/auth"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func dialGRPC(t *testing.T, s *Server) *grpc.ClientConn {
+	hs := httptest.NewServer(s.GRPCHandler())
+	t.Cleanup(hs.Close)
+	conn, err := grpc.Dial(strings.TrimPrefix(hs.URL, "http://"), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestGRPC(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo, &Greeter{})
+	conn := dialGRPC(t, s)
+	ctx := context.Background()
+
+	for _, method := range []string{"/test_service.FBoo/Sum", "/FBoo/Sum"} {
+		var reply test_service.FBooReply
+		if err := conn.Invoke(ctx, method, &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		_assert(reply.Num == 3, "expect 3, got %d", reply.Num)
+	}
+
+	var reply test_service.FBooReply
+	err := conn.Invoke(ctx, "/test_service.FBoo/Missing", &test_service.FBooArgs{}, &reply)
+	_assert(status.Code(err) == codes.Unimplemented, "expect Unimplemented, got %v", err)
+
+	// 参数不是proto消息的方法无法通过gRPC调用
+	err = conn.Invoke(ctx, "/Greeter/Hello", &test_service.FBooArgs{}, &reply)
+	_assert(status.Code(err) == codes.Unimplemented, "expect Unimplemented, got %v", err)
+
+	st := s.metrics.stats("FBoo.Sum")
+	_assert(st.calls == 2 && st.errors == 0, "unexpected stats %+v", st)
+}
+
+func TestGRPC_Timeout(t *testing.T) {
+	sleeper := &Sleeper{canceled: make(chan error, 1)}
+	s := newTestServer(t, sleeper)
+	hs := httptest.NewServer(s.GRPCHandler())
+	t.Cleanup(hs.Close)
+
+	// 直接发送带 grpc-timeout 的请求，客户端自身没有截止时间，不会先于服务端重置流
+	body, err := proto.Marshal(&test_service.FBooArgs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 5+len(body))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(body)))
+	copy(frame[5:], body)
+	req, _ := http.NewRequest(http.MethodPost, hs.URL+"/Sleeper/Wait", bytes.NewReader(frame))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("Grpc-Timeout", "50m")
+	tr := &http2.Transport{AllowHTTP: true, DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+		return net.Dial(network, addr)
+	}}
+	t.Cleanup(tr.CloseIdleConnections)
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	got := resp.Trailer.Get("Grpc-Status")
+	_assert(got == strconv.Itoa(int(codes.DeadlineExceeded)), "expect grpc-status DeadlineExceeded, got %q", got)
+	select {
+	case err = <-sleeper.canceled:
+		_assert(err == context.DeadlineExceeded, "expect handler deadline exceeded, got %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("handler ctx not canceled")
+	}
+}
+
+func TestGRPC_Auth(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	s.WithAuth(auth.NewTokenAuthenticator(map[string]*auth.Identity{
+		"alice-token": {Principal: "alice", Roles: []string{"admin"}},
+		"bob-token":   {Principal: "bob"},
+	}), auth.NewAuthorizer(&auth.Policy{
+		DefaultDeny: true,
+		Rules: []auth.Rule{
+			{Method: "FBoo.Sum", Allow: auth.Subjects{Roles: []string{"admin"}}},
+		},
+	}))
+	conn := dialGRPC(t, s)
+
+	invoke := func(token string) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+		var reply test_service.FBooReply
+		return conn.Invoke(ctx, "/test_service.FBoo/Sum", &test_service.FBooArgs{Num1: 1}, &reply)
+	}
+	err := invoke("bad")
+	_assert(status.Code(err) == codes.Unauthenticated, "expect Unauthenticated, got %v", err)
+	err = invoke("bob-token")
+	_assert(status.Code(err) == codes.PermissionDenied, "expect PermissionDenied, got %v", err)
+	err = invoke("alice-token")
+	_assert(err == nil, "expect ok, got %v", err)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"sync"
+
+	healthpb "github.com/yx-Anbf1a/anbrpc/health"
+	"go.uber.org/zap"
+)
+
+// HealthServiceName 内置健康检查服务的服务名
+const HealthServiceName = "Health"
+
+// Health 内置健康检查服务，服务名为空表示整个Server的状态
+type Health struct {
+	mu       sync.RWMutex
+	statuses map[string]healthpb.ServingStatus
+	onChange func(service string, status healthpb.ServingStatus)
+}
+
+func newHealth() *Health {
+	return &Health{
+		statuses: map[string]healthpb.ServingStatus{"": healthpb.ServingStatus_SERVING},
+	}
+}
+
+// Check 查询服务状态
+func (h *Health) Check(args *healthpb.HealthCheckRequest) *healthpb.HealthCheckResponse {
+	return &healthpb.HealthCheckResponse{Status: h.servingStatus(args.Service)}
+}
+
+func (h *Health) servingStatus(service string) healthpb.ServingStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status, ok := h.statuses[service]
+	if !ok {
+		return healthpb.ServingStatus_SERVICE_UNKNOWN
+	}
+	return status
+}
+
+func (h *Health) setServingStatus(service string, status healthpb.ServingStatus) {
+	h.mu.Lock()
+	old, ok := h.statuses[service]
+	h.statuses[service] = status
+	onChange := h.onChange
+	h.mu.Unlock()
+	if ok && old == status {
+		return
+	}
+	if onChange != nil {
+		onChange(service, status)
+	}
+}
+
+// clearServingStatus 服务注销后移除其状态
+func (h *Health) clearServingStatus(service string) {
+	h.mu.Lock()
+	_, ok := h.statuses[service]
+	delete(h.statuses, service)
+	onChange := h.onChange
+	h.mu.Unlock()
+	if ok && onChange != nil {
+		onChange(service, healthpb.ServingStatus_SERVICE_UNKNOWN)
+	}
+}
+
+// serving 整个Server和指定服务都处于SERVING
+func (h *Health) serving(service string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.statuses[""] != healthpb.ServingStatus_SERVING {
+		return false
+	}
+	if service == "" {
+		return true
+	}
+	return h.statuses[service] == healthpb.ServingStatus_SERVING
+}
+
+// SetServingStatus 设置服务的健康状态，service为空表示整个Server
+// 注册中心的节点随之更新：NOT_SERVING 时从etcd中移除，恢复后重新写入
+func (s *Server) SetServingStatus(service string, status healthpb.ServingStatus) {
+	s.health.setServingStatus(service, status)
+}
+
+// ServingStatus 获取服务的健康状态
+func (s *Server) ServingStatus(service string) healthpb.ServingStatus {
+	return s.health.servingStatus(service)
+}
+
+// syncRegistration 根据健康状态更新注册中心
+func (s *Server) syncRegistration(string, healthpb.ServingStatus) {
+	s.mu.Lock()
+	register := s.register
+	s.mu.Unlock()
+	if register == nil {
+		return
+	}
+	for key, service := range register.services() {
+		if err := register.SetServing(key, s.health.serving(service)); err != nil {
+			s.logger.Error("rpc server: update registry by health status error", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
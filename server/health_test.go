@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	healthpb "github.com/yx-Anbf1a/anbrpc/health"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+func TestHealth_Check(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	c := dialTestServer(t, s)
+
+	check := func(service string) healthpb.ServingStatus {
+		var reply healthpb.HealthCheckResponse
+		if err := c.Call(context.Background(), "Health.Check", &healthpb.HealthCheckRequest{Service: service}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply.Status
+	}
+	_assert(check("") == healthpb.ServingStatus_SERVING, "server should be serving")
+	_assert(check("FBoo") == healthpb.ServingStatus_SERVING, "registered service should be serving")
+	_assert(check("Nope") == healthpb.ServingStatus_SERVICE_UNKNOWN, "unknown service")
+
+	var changed []string
+	s.health.onChange = func(service string, status healthpb.ServingStatus) {
+		changed = append(changed, service+"="+status.String())
+	}
+	s.SetServingStatus("FBoo", healthpb.ServingStatus_NOT_SERVING)
+	s.SetServingStatus("FBoo", healthpb.ServingStatus_NOT_SERVING)
+	_assert(check("FBoo") == healthpb.ServingStatus_NOT_SERVING, "FBoo should be not serving")
+	_assert(!s.health.serving("FBoo") && s.health.serving(""), "unexpected serving state")
+	_assert(len(changed) == 1 && changed[0] == "FBoo=NOT_SERVING", "expect one change, got %v", changed)
+
+	s.SetServingStatus("FBoo", healthpb.ServingStatus_SERVING)
+	s.SetServingStatus("", healthpb.ServingStatus_NOT_SERVING)
+	_assert(!s.health.serving("FBoo"), "server not serving makes every service not serving")
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/idempotency"
+	"google.golang.org/protobuf/proto"
+)
+
+// idempotencyGuard 按幂等键保存响应，同一个键同时只有一个请求执行，其余的等待它的结果
+type idempotencyGuard struct {
+	store idempotency.Store
+
+	mu      sync.Mutex
+	running map[string]chan struct{} // 正在执行的 方法+幂等键
+}
+
+// WithIdempotency 开启幂等键支持，带相同幂等键的重试请求直接返回保存的响应，不再执行方法
+// 只保存成功的响应，流式方法和单向调用不受影响；响应与编解码器无关地保存，重试可以换用其他编解码器或HTTP网关、gRPC
+func (s *Server) WithIdempotency(store idempotency.Store) {
+	s.idem = &idempotencyGuard{store: store, running: make(map[string]chan struct{})}
+}
+
+// acquire 返回已保存的响应；没有时占用幂等键，调用方在方法返回后通过 release 保存响应并唤醒等待者，
+// resp为nil时不保存，等待者会重新竞争执行
+func (g *idempotencyGuard) acquire(ctx context.Context, serviceMethod, key string) (*idempotency.Response, func(resp *idempotency.Response), error) {
+	id := serviceMethod + "\x00" + key
+	for {
+		// 存储可能访问远程服务，不在锁内查询
+		if resp, ok := g.store.Get(serviceMethod, key); ok {
+			return resp, nil, nil
+		}
+		g.mu.Lock()
+		wait, busy := g.running[id]
+		if !busy {
+			done := make(chan struct{})
+			g.running[id] = done
+			g.mu.Unlock()
+			release := g.releaser(serviceMethod, key, id, done)
+			// 上一个执行者可能在两次查询之间保存了响应并释放了键
+			if resp, ok := g.store.Get(serviceMethod, key); ok {
+				release(nil)
+				return resp, nil, nil
+			}
+			return nil, release, nil
+		}
+		g.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// releaser 先保存响应再释放键，之后占用键的请求一定能查到保存的响应
+func (g *idempotencyGuard) releaser(serviceMethod, key, id string, done chan struct{}) func(*idempotency.Response) {
+	var once sync.Once
+	return func(resp *idempotency.Response) {
+		once.Do(func() {
+			if resp != nil {
+				g.store.Put(serviceMethod, key, resp)
+			}
+			g.mu.Lock()
+			delete(g.running, id)
+			g.mu.Unlock()
+			close(done)
+		})
+	}
+}
+
+// idempotencyKey 请求的幂等键，带身份时按调用方隔离；未开启或单向调用时返回空
+func (s *Server) idempotencyKey(req *request) string {
+	if s.idem == nil || req.h.OneWay {
+		return ""
+	}
+	key := idempotency.Key(req.md)
+	if key != "" && req.identity != nil {
+		key = req.identity.Principal + "/" + key
+	}
+	return key
+}
+
+// encodeResponse proto消息以proto编码保存，其他响应以JSON编码保存
+func encodeResponse(reply interface{}) (*idempotency.Response, error) {
+	if m, ok := reply.(proto.Message); ok {
+		body, err := proto.Marshal(m)
+		return &idempotency.Response{Codec: codec.ProtoTyp, Body: body}, err
+	}
+	body, err := json.Marshal(reply)
+	return &idempotency.Response{Codec: codec.JsonType, Body: body}, err
+}
+
+// decodeResponse 按保存时的编码解码响应
+func decodeResponse(resp *idempotency.Response, reply interface{}) error {
+	switch resp.Codec {
+	case codec.ProtoTyp:
+		m, ok := reply.(proto.Message)
+		if !ok {
+			return fmt.Errorf("rpc server: replay response: %T is not a proto.Message", reply)
+		}
+		return proto.Unmarshal(resp.Body, m)
+	case codec.JsonType:
+		return json.Unmarshal(resp.Body, reply)
+	default:
+		return fmt.Errorf("rpc server: replay response: unknown codec %q", resp.Codec)
+	}
+}
+
+// saveResponse 方法返回后保存成功的响应并释放幂等键，调用方是否还在等待都保存
+func saveResponse(reply interface{}, err error, release func(*idempotency.Response)) {
+	if err != nil {
+		release(nil)
+		return
+	}
+	resp, err := encodeResponse(reply)
+	if err != nil {
+		release(nil)
+		return
+	}
+	release(resp)
+}
+
+// replay 发送保存的响应
+func (s *Server) replay(cc codec.Codec, req *request, resp *idempotency.Response, sending *sync.Mutex) (string, int32) {
+	reply := req.mtype.newReply()
+	if err := decodeResponse(resp, reply.Interface()); err != nil {
+		req.h.Error = err.Error()
+		return statusError, s.sendResponse(cc, req.h, invalidRequest, sending)
+	}
+	return statusOK, s.sendResponse(cc, req.h, reply.Interface(), sending)
+}
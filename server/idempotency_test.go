@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/idempotency"
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+// Payment 非幂等方法，每次执行返回新的流水号
+type Payment struct {
+	charges int32
+}
+
+func (p *Payment) Charge(args *test_service.FBooArgs) *test_service.FBooReply {
+	time.Sleep(20 * time.Millisecond)
+	return &test_service.FBooReply{Num: atomic.AddInt32(&p.charges, 1)}
+}
+
+func TestServer_Idempotency(t *testing.T) {
+	p := &Payment{}
+	s := newTestServer(t, p)
+	s.WithIdempotency(idempotency.NewMemoryStore(100, time.Minute))
+	c := dialTestServer(t, s)
+
+	charge := func(ctx context.Context) int32 {
+		var reply test_service.FBooReply
+		if err := c.Call(ctx, "Payment.Charge", &test_service.FBooArgs{}, &reply); err != nil {
+			t.Error(err)
+		}
+		return reply.Num
+	}
+
+	ctx := idempotency.WithKey(context.Background(), "order-1")
+	first := charge(ctx)
+	_assert(charge(ctx) == first, "retry should replay the first response")
+
+	// 并发的重试等待正在执行的请求
+	ctx = idempotency.WithKey(context.Background(), "order-2")
+	var wg sync.WaitGroup
+	got := make([]int32, 5)
+	for i := range got {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got[i] = charge(ctx)
+		}(i)
+	}
+	wg.Wait()
+	for _, n := range got {
+		_assert(n == got[0], "concurrent retries should share one response, got %v", got)
+	}
+
+	// 没有幂等键的请求每次都执行
+	charge(context.Background())
+	_assert(atomic.LoadInt32(&p.charges) == 3, "expect 3 charges, got %d", atomic.LoadInt32(&p.charges))
+}
+
+func TestServer_IdempotencyAbandoned(t *testing.T) {
+	p := &Payment{}
+	s := newTestServer(t, p)
+	s.WithIdempotency(idempotency.NewMemoryStore(100, time.Minute))
+	c := dialTestServer(t, s)
+
+	// 调用方在方法返回前放弃，重试等待仍在执行的方法并返回它的结果
+	ctx := idempotency.WithKey(context.Background(), "pay-1")
+	tctx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	var reply test_service.FBooReply
+	err := c.Call(tctx, "Payment.Charge", &test_service.FBooArgs{}, &reply)
+	_assert(err != nil, "expect the first call to time out")
+	if err = c.Call(ctx, "Payment.Charge", &test_service.FBooArgs{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 1 && atomic.LoadInt32(&p.charges) == 1, "expect one charge, got reply %d, charges %d", reply.Num, atomic.LoadInt32(&p.charges))
+}
+
+func TestServer_IdempotencyAcrossCodecs(t *testing.T) {
+	p := &Payment{}
+	s := newTestServer(t, p)
+	s.WithIdempotency(idempotency.NewMemoryStore(100, time.Minute))
+	ctx := idempotency.WithKey(context.Background(), "pay-2")
+
+	// 同一个幂等键的重试可以换用其他编解码器
+	for _, codecType := range []codec.Type{codec.ProtoTyp, codec.JsonType, codec.GobType} {
+		opt := *option.DefaultOption
+		opt.CodecType = codecType
+		c := dialTestServer(t, s, &opt)
+		var reply test_service.FBooReply
+		if err := c.Call(ctx, "Payment.Charge", &test_service.FBooArgs{}, &reply); err != nil {
+			t.Fatalf("%s: %v", codecType, err)
+		}
+		_assert(reply.Num == 1, "%s: expect replayed 1, got %d", codecType, reply.Num)
+	}
+	// 不经过连接的请求同样使用幂等键
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/rpc/Payment/Charge", strings.NewReader(`{}`))
+		r.Header.Set(idempotency.MetadataKey, "pay-3")
+		w := httptest.NewRecorder()
+		s.GatewayHandler("").ServeHTTP(w, r)
+		var reply test_service.FBooReply
+		_assert(w.Code == http.StatusOK && json.Unmarshal(w.Body.Bytes(), &reply) == nil, "unexpected gateway response %d %s", w.Code, w.Body)
+		_assert(reply.Num == 2, "expect gateway replay 2, got %d", reply.Num)
+	}
+	_assert(atomic.LoadInt32(&p.charges) == 2, "expect 2 charges, got %d", atomic.LoadInt32(&p.charges))
+}
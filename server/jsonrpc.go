@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/option"
+)
+
+// maxJSONRPCBody HTTP方式的JSON-RPC请求体大小上限
+const maxJSONRPCBody = 4 << 20
+
+// jsonrpcConn 先读出识别协议用的第一个JSON值，再继续读连接
+type jsonrpcConn struct {
+	r io.Reader
+	io.ReadWriteCloser
+}
+
+func (c jsonrpcConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// serveJSONRPC 处理JSON-RPC 2.0连接，使用默认Option，不支持流式方法
+func (s *Server) serveJSONRPC(conn io.ReadWriteCloser, ci *connInfo) {
+	opt := *option.DefaultOption
+	opt.CodecType = codec.JSONRPCType
+	ci.setCodec(codec.JSONRPCType)
+	s.serveCodec(codec.NewJSONRPCCodec(conn), &opt, ci)
+}
+
+type jsonrpcHTTP struct {
+	*Server
+}
+
+// httpBody 请求体作为读取端，响应写入缓冲区
+type httpBody struct {
+	io.Reader
+	io.Writer
+}
+
+func (httpBody) Close() error { return nil }
+
+// JSONRPCHandler 通过HTTP POST接受JSON-RPC 2.0的单个或批量请求，HTTP头作为请求元数据
+func (s *Server) JSONRPCHandler() http.Handler {
+	return jsonrpcHTTP{s}
+}
+
+func (server jsonrpcHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "405 must POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var out bytes.Buffer
+	cc := codec.NewJSONRPCCodec(httpBody{Reader: http.MaxBytesReader(w, r.Body, maxJSONRPCBody), Writer: &out})
+	md := headerMetadata(r.Header)
+	var wg sync.WaitGroup
+	for {
+		req, err := server.readRequest(cc)
+		start := time.Now()
+		if req != nil {
+			req.md = md
+			req.peer = httpPeer(r, codec.JSONRPCType)
+		}
+		if err != nil {
+			if req == nil {
+				break
+			}
+			req.h.Error = err.Error()
+			_ = cc.Write(req.h, invalidRequest)
+			server.rejectRequest(req, err, start, 0)
+			continue
+		}
+		if req.mtype.ServerStreaming {
+			req.h.Error = "rpc server: stream method " + req.h.ServiceMethod + " is not supported over JSON-RPC"
+			_ = cc.Write(req.h, invalidRequest)
+			server.rejectRequest(req, nil, start, 0)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.handleJSONRPC(r.Context(), cc, req)
+		}()
+	}
+	wg.Wait()
+	// 全部是通知时没有响应
+	if out.Len() == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(out.Bytes())
+}
+
+// handleJSONRPC 批量请求中的每个请求并发执行，响应由编解码器合并
+func (s *Server) handleJSONRPC(ctx context.Context, cc codec.Codec, req *request) {
+	start, status := time.Now(), statusOK
+	s.metrics.begin(req.metricsMethod())
+	defer func() {
+		s.finishRequest(req, status, start, 0)
+	}()
+
+	if err := s.authorize(req); err != nil {
+		status = authStatus(err)
+		req.h.Error = err.Error()
+		_ = cc.Write(req.h, invalidRequest)
+		return
+	}
+	if timeout := req.mtype.timeout(option.DefaultOption.HandleTimeOut); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var err error
+	status, err = s.callDirect(ctx, req)
+	switch status {
+	case statusOK:
+		_ = cc.Write(req.h, req.replyv.Interface())
+	case statusCanceled:
+		// 调用方断开了连接，不再响应
+	default:
+		req.h.Error = err.Error()
+		_ = cc.Write(req.h, invalidRequest)
+	}
+}
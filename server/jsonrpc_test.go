@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+type jsonrpcReply struct {
+	Result *test_service.FBooReply `json:"result"`
+	Error  *codec.JSONRPCError     `json:"error"`
+	ID     json.RawMessage         `json:"id"`
+}
+
+func TestJSONRPC_TCP(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo, &Relay{})
+	cliConn, srvConn := net.Pipe()
+	defer cliConn.Close()
+	go s.serveConn(srvConn)
+	dec := json.NewDecoder(cliConn)
+	send := func(msg string) {
+		if _, err := io.WriteString(cliConn, msg+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 不需要发送Option，第一个值就是请求
+	send(`{"jsonrpc":"2.0","method":"FBoo.Sum","params":{"Num1":1,"Num2":2},"id":1}`)
+	var reply jsonrpcReply
+	if err := dec.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(string(reply.ID) == "1", "expect id 1, got %s", reply.ID)
+	_assert(reply.Error == nil && reply.Result.Num == 3, "unexpected reply %+v", reply)
+
+	// 按位置传参
+	send(`{"jsonrpc":"2.0","method":"FBoo.Sum","params":[{"Num1":2,"Num2":3}],"id":"two"}`)
+	reply = jsonrpcReply{}
+	if err := dec.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(string(reply.ID) == `"two"`, "expect id \"two\", got %s", reply.ID)
+	_assert(reply.Error == nil && reply.Result.Num == 5, "unexpected reply %+v", reply)
+
+	// JSON-RPC连接无法反向调用，处理方法拿不到 Callback
+	send(`{"jsonrpc":"2.0","method":"Relay.Double","params":{"Num1":1},"id":"cb"}`)
+	reply = jsonrpcReply{}
+	if err := dec.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Error == nil && reply.Result.Num == -1, "expect no callback, got %+v", reply)
+
+	// 参数错误后连接仍然可用
+	send(`{"jsonrpc":"2.0","method":"FBoo.Sum","params":{"Num1":"x"},"id":3}`)
+	reply = jsonrpcReply{}
+	if err := dec.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Error != nil && reply.Error.Code == codec.JSONRPCInvalidParams, "expect invalid params, got %+v", reply.Error)
+
+	send(`[
+		{"jsonrpc":"2.0","method":"FBoo.Sum","params":{"Num1":4},"id":"a"},
+		{"jsonrpc":"2.0","method":"FBoo.Sum","params":{"Num1":5}},
+		{"jsonrpc":"2.0","method":"FBoo.Missing","id":"b"},
+		{"method":"FBoo.Sum","id":"c"}
+	]`)
+	var batch []jsonrpcReply
+	if err := dec.Decode(&batch); err != nil {
+		t.Fatal(err)
+	}
+	_assert(len(batch) == 3, "expect 3 responses, got %d", len(batch))
+	byID := make(map[string]jsonrpcReply)
+	for _, r := range batch {
+		byID[string(r.ID)] = r
+	}
+	_assert(byID[`"a"`].Result != nil && byID[`"a"`].Result.Num == 4, "unexpected reply %+v", byID[`"a"`])
+	_assert(byID[`"b"`].Error != nil && byID[`"b"`].Error.Code == codec.JSONRPCMethodNotFound, "expect method not found, got %+v", byID[`"b"`])
+	_assert(byID[`"c"`].Error != nil && byID[`"c"`].Error.Code == codec.JSONRPCInvalidRequest, "expect invalid request, got %+v", byID[`"c"`])
+
+	// 无法解析时回复后关闭连接
+	send(`{"jsonrpc":`)
+	send(`}`)
+	reply = jsonrpcReply{}
+	if err := dec.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Error != nil && reply.Error.Code == codec.JSONRPCParseError, "expect parse error, got %+v", reply.Error)
+	_ = cliConn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := cliConn.Read(make([]byte, 1))
+	_assert(err == io.EOF, "expect connection closed, got %v", err)
+}
+
+func TestJSONRPC_HTTP(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	h := s.JSONRPCHandler()
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"jsonrpc":"2.0","method":"FBoo.Sum","params":{"Num1":1,"Num2":2},"id":7}`)
+	_assert(w.Code == http.StatusOK, "expect 200, got %d", w.Code)
+	var reply jsonrpcReply
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(string(reply.ID) == "7" && reply.Result.Num == 3, "unexpected reply %+v", reply)
+
+	w = post(`[{"jsonrpc":"2.0","method":"FBoo.Sum","params":{"Num1":1},"id":1},{"jsonrpc":"2.0","method":"FBoo.Sum","params":{"Num1":2},"id":2}]`)
+	var batch []jsonrpcReply
+	if err := json.Unmarshal(w.Body.Bytes(), &batch); err != nil {
+		t.Fatal(err)
+	}
+	_assert(len(batch) == 2, "expect 2 responses, got %d", len(batch))
+
+	// 只有通知时没有响应
+	w = post(`{"jsonrpc":"2.0","method":"FBoo.Sum","params":{"Num1":1}}`)
+	_assert(w.Code == http.StatusNoContent, "expect 204, got %d", w.Code)
+	w = post(`[]`)
+	reply = jsonrpcReply{}
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Error != nil && reply.Error.Code == codec.JSONRPCInvalidRequest, "expect invalid request, got %+v", reply.Error)
+
+	st := s.metrics.stats("FBoo.Sum")
+	_assert(st.calls == 4 && st.errors == 0, "unexpected stats %+v", st)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+func TestKeepalive_IdleClientStaysAlive(t *testing.T) {
+	params := option.KeepaliveParams{Interval: 20 * time.Millisecond, Timeout: 100 * time.Millisecond}
+	for _, codecType := range []codec.Type{codec.ProtoTyp, codec.JsonType, codec.GobType} {
+		s := newTestServer(t, &Counter{})
+		s.WithKeepalive(params)
+		c := dialTestServer(t, s, &option.Option{CodecType: codecType, Keepalive: params})
+
+		// 两端互相PING，空闲连接不会被关闭
+		time.Sleep(300 * time.Millisecond)
+		_assert(c.IsAlive(), "%s: idle client should stay alive", codecType)
+		var reply test_service.FBooReply
+		if err := c.Call(context.Background(), "Counter.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatalf("%s: %v", codecType, err)
+		}
+		_assert(reply.Num == 3, "%s: unexpected reply %v", codecType, reply.Num)
+	}
+}
+
+func TestKeepalive_ClientIdleTimeout(t *testing.T) {
+	s := newTestServer(t, &Counter{})
+	c := dialTestServer(t, s, &option.Option{Keepalive: option.KeepaliveParams{Idle: 50 * time.Millisecond}})
+	var reply test_service.FBooReply
+	if err := c.Call(context.Background(), "Counter.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for c.IsAlive() {
+		if time.Now().After(deadline) {
+			t.Fatal("expect idle client closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestKeepalive_ServerClosesDeadPeer(t *testing.T) {
+	s := newTestServer(t)
+	s.WithKeepalive(option.KeepaliveParams{Interval: 20 * time.Millisecond, Timeout: 50 * time.Millisecond})
+	cliConn, srvConn := net.Pipe()
+	defer cliConn.Close()
+	done := make(chan struct{})
+	go func() {
+		s.serveConn(srvConn)
+		close(done)
+	}()
+	// 完成握手后不再读写，服务端的PING得不到回应
+	if err := json.NewEncoder(cliConn).Encode(option.DefaultOption); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect server to close dead connection")
+	}
+	_assert(atomic.LoadInt64(&s.metrics.connections) == 0, "connection should be untracked")
+
+	// 只设置 Interval 时使用默认的 Timeout
+	s.WithKeepalive(option.KeepaliveParams{Interval: 20 * time.Millisecond})
+	_assert(s.keepalive.Timeout == option.DefaultKeepalive.Timeout, "expect default timeout, got %v", s.keepalive.Timeout)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// 连接被拒绝的原因
+const (
+	rejectMaxConnections      = "max_connections"
+	rejectMaxConnectionsPerIP = "max_connections_per_ip"
+)
+
+// connLimiter 限制总连接数和每个远端IP的连接数，0表示不限制
+type connLimiter struct {
+	maxConns int
+	maxPerIP int
+
+	mu    sync.Mutex
+	total int
+	perIP map[string]int
+}
+
+func newConnLimiter() *connLimiter {
+	return &connLimiter{perIP: make(map[string]int)}
+}
+
+// acquire 占用一个连接名额，超限时返回拒绝原因，成功时连接关闭后需要调用release
+func (l *connLimiter) acquire(ip string) (release func(), reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxConns > 0 && l.total >= l.maxConns {
+		return nil, rejectMaxConnections
+	}
+	if l.maxPerIP > 0 && ip != "" && l.perIP[ip] >= l.maxPerIP {
+		return nil, rejectMaxConnectionsPerIP
+	}
+	l.total++
+	l.perIP[ip]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.total--
+		if l.perIP[ip]--; l.perIP[ip] <= 0 {
+			delete(l.perIP, ip)
+		}
+	}, ""
+}
+
+// remoteIP 连接的远端IP，无法获取时返回空
+func remoteIP(conn io.ReadWriteCloser) string {
+	nc, ok := conn.(net.Conn)
+	if !ok || nc.RemoteAddr() == nil {
+		return ""
+	}
+	addr := nc.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+func TestConnLimiter(t *testing.T) {
+	l := newConnLimiter()
+	l.maxConns, l.maxPerIP = 3, 2
+
+	r1, reason := l.acquire("10.0.0.1")
+	_assert(reason == "", "unexpected reject %s", reason)
+	_, reason = l.acquire("10.0.0.1")
+	_assert(reason == "", "unexpected reject %s", reason)
+	_, reason = l.acquire("10.0.0.1")
+	_assert(reason == rejectMaxConnectionsPerIP, "expect per ip reject, got %q", reason)
+	_, reason = l.acquire("10.0.0.2")
+	_assert(reason == "", "unexpected reject %s", reason)
+	_, reason = l.acquire("10.0.0.3")
+	_assert(reason == rejectMaxConnections, "expect total reject, got %q", reason)
+
+	r1()
+	_, reason = l.acquire("10.0.0.1")
+	_assert(reason == "", "released slot should be reusable, got %q", reason)
+}
+
+func TestServer_MaxConns(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	s.limiter.maxConns = 1
+	dialTestServer(t, s)
+
+	cliConn, srvConn := net.Pipe()
+	defer cliConn.Close()
+	done := make(chan struct{})
+	go func() {
+		s.serveConn(srvConn)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect connection over limit rejected")
+	}
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+	_assert(s.metrics.rejections[rejectMaxConnections] == 1, "expect rejection recorded, got %v", s.metrics.rejections)
+}
+
+func TestServer_HandshakeTimeout(t *testing.T) {
+	s := newTestServer(t)
+	s.handshakeTimeout = 50 * time.Millisecond
+	cliConn, srvConn := net.Pipe()
+	defer cliConn.Close()
+	done := make(chan struct{})
+	go func() {
+		s.serveConn(srvConn)
+		close(done)
+	}()
+	// 客户端不发送Option
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect handshake timeout")
+	}
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+	_assert(s.metrics.handshakeFailures["handshake_timeout"] == 1, "expect handshake timeout recorded, got %v", s.metrics.handshakeFailures)
+}
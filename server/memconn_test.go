@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/client"
+	"github.com/yx-Anbf1a/anbrpc/memconn"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+	"go.uber.org/zap"
+)
+
+func TestServer_ServeMemconn(t *testing.T) {
+	lis, err := memconn.Listen("anbrpc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("", WithListener(lis), WithLogger(zap.NewNop()))
+	_assert(s.Host == "mem@anbrpc-test", "unexpected host %s", s.Host)
+	var foo test_service.FBoo
+	if _, err = s._register(&foo); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Serve(lis)
+		close(done)
+	}()
+
+	conn, err := memconn.Dial("anbrpc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.Dial(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var reply test_service.FBooReply
+	if err = c.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 3, "expect 3, got %d", reply.Num)
+
+	_ = s.Close()
+	<-done
+}
+
+func TestServer_ServeReplacesListener(t *testing.T) {
+	s := NewServer("127.0.0.1:0", WithLogger(zap.NewNop()))
+	addr := s.l.Addr().String()
+	lis, err := memconn.Listen("anbrpc-replace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Serve(lis)
+		close(done)
+	}()
+
+	// NewServer 打开的Listener被关闭
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		_ = conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("expect the listener opened by NewServer to be closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	s.mu.Lock()
+	host := s.Host
+	s.mu.Unlock()
+	_assert(host == "mem@anbrpc-replace", "unexpected host %s", host)
+
+	_ = s.Close()
+	<-done
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/logger"
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// applyMethodOptions 在服务对外可见之前设置方法选项，方法不存在或日志级别无效时返回错误
+func (svc *Service) applyMethodOptions(methods map[string]option.MethodOptions, lg *zap.Logger) error {
+	for name, opts := range methods {
+		m, ok := svc.method[name]
+		if !ok {
+			return fmt.Errorf("rpc server: method options for unknown method %s.%s", svc.name, name)
+		}
+		m.opts, m.logger = opts, lg
+		if opts.LogLevel != "" {
+			level, err := zapcore.ParseLevel(opts.LogLevel)
+			if err != nil {
+				return fmt.Errorf("rpc server: method %s.%s: %w", svc.name, name, err)
+			}
+			m.logger = logger.WithLevel(lg, level)
+		}
+	}
+	return nil
+}
+
+// methodOptions 设置了选项的方法，写入注册中心
+func (svc *Service) methodOptions() map[string]option.MethodOptions {
+	var methods map[string]option.MethodOptions
+	for name, m := range svc.method {
+		if m.opts.IsZero() {
+			continue
+		}
+		if methods == nil {
+			methods = make(map[string]option.MethodOptions)
+		}
+		methods[name] = m.opts
+	}
+	return methods
+}
+
+// Options 注册时设置的方法选项
+func (m *MethodType) Options() option.MethodOptions {
+	return m.opts
+}
+
+// timeout 处理超时，方法设置了超时时优先使用；否则一元方法使用连接的超时，流可能长时间存在，不受其限制
+func (m *MethodType) timeout(def time.Duration) time.Duration {
+	if m.opts.Timeout > 0 {
+		return m.opts.Timeout
+	}
+	if m.ServerStreaming {
+		return 0
+	}
+	return def
+}
+
+// errRequestTooLarge 请求体超过方法的 MaxRequestSize
+var errRequestTooLarge = errors.New("rpc server: request too large")
+
+// checkSize 检查请求体大小，size为0表示编解码器无法得知大小
+func (m *MethodType) checkSize(size int32) error {
+	if max := m.opts.MaxRequestSize; max > 0 && size > max {
+		return fmt.Errorf("%w: size %d exceeds limit %d", errRequestTooLarge, size, max)
+	}
+	return nil
+}
+
+// maxRequestSize 方法的请求体大小上限，供读取头部时就读入消息体的编解码器提前限制，找不到方法时不限制
+func (s *Server) maxRequestSize(serviceMethod string) int32 {
+	_, mtype, err := s.findService(serviceMethod)
+	if err != nil {
+		return 0
+	}
+	return mtype.opts.MaxRequestSize
+}
+
+// acquire 占用一个并发名额，达到 MaxConcurrency 时返回false
+func (m *MethodType) acquire() bool {
+	if m.opts.MaxConcurrency <= 0 {
+		return true
+	}
+	if atomic.AddInt64(m.active, 1) > int64(m.opts.MaxConcurrency) {
+		atomic.AddInt64(m.active, -1)
+		return false
+	}
+	return true
+}
+
+func (m *MethodType) release() {
+	if m.opts.MaxConcurrency > 0 {
+		atomic.AddInt64(m.active, -1)
+	}
+}
+
+// inheritMethodOptions 替换服务时沿用旧实现同名方法的选项和并发计数，旧实现上仍在执行的请求继续占用名额
+func (svc *Service) inheritMethodOptions(old *Service) {
+	for name, m := range svc.method {
+		if om, ok := old.method[name]; ok {
+			m.opts, m.logger, m.active = om.opts, om.logger, om.active
+		}
+	}
+}
+
+// requestLogger 请求的访问日志和错误日志使用方法的Logger，方法设置了 LogLevel 时按其级别输出
+func (s *Server) requestLogger(req *request) *zap.Logger {
+	if req.mtype != nil && req.mtype.logger != nil {
+		return req.mtype.logger
+	}
+	return s.logger
+}
+
+func errTooManyRequests(serviceMethod string) error {
+	return fmt.Errorf("rpc server: too many concurrent requests to %s", serviceMethod)
+}
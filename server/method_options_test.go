@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+func TestServer_MethodOptions(t *testing.T) {
+	s := newTestServer(t)
+	err := s.RegisterName("FBoo", &test_service.FBoo{}, RegisterConfig{Methods: map[string]option.MethodOptions{
+		"Sum":   {MaxRequestSize: 12, Idempotent: true, LogLevel: "debug"},
+		"Sleep": {MaxConcurrency: 1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RegisterName("Slow", &test_service.FBoo{}, RegisterConfig{Methods: map[string]option.MethodOptions{
+		"Sleep": {Timeout: 100 * time.Millisecond},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, codecType := range []codec.Type{codec.ProtoTyp, codec.JsonType} {
+		opt := *option.DefaultOption
+		opt.CodecType = codecType
+		c := dialTestServer(t, s, &opt)
+		var reply test_service.FBooReply
+
+		// 方法的超时覆盖连接的 HandleTimeOut
+		start := time.Now()
+		err = c.Call(context.Background(), "Slow.Sleep", &test_service.FBooArgs{}, &reply)
+		_assert(err != nil && strings.Contains(err.Error(), "timeout"), "%s: expect timeout, got %v", codecType, err)
+		_assert(time.Since(start) < time.Second/2, "%s: method timeout not applied", codecType)
+
+		// 超过大小的请求被拒绝，连接仍然可用；负数在proto中占10字节
+		err = c.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{Num1: -1, Num2: -1}, &reply)
+		_assert(err != nil && strings.Contains(err.Error(), "exceeds limit"), "%s: expect size error, got %v", codecType, err)
+		err = c.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{Num1: 1}, &reply)
+		_assert(err == nil && reply.Num == 1, "%s: expect 1, got %d %v", codecType, reply.Num, err)
+	}
+	// 被拒绝的请求计入指标
+	mm := s.metrics.method("FBoo.Sum")
+	mm.mu.Lock()
+	rejected := mm.statuses[statusResourceExhausted]
+	mm.mu.Unlock()
+	_assert(rejected == 2, "expect 2 oversize requests in metrics, got %d", rejected)
+
+	// 超过并发数的请求直接返回错误
+	c := dialTestServer(t, s)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Call(context.Background(), "FBoo.Sleep", &test_service.FBooArgs{}, &test_service.FBooReply{})
+	}()
+	for s.metrics.stats("FBoo.Sleep").inFlight == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	err = c.Call(context.Background(), "FBoo.Sleep", &test_service.FBooArgs{}, &test_service.FBooReply{})
+	_assert(err != nil && strings.Contains(err.Error(), "too many concurrent"), "expect concurrency error, got %v", err)
+	_assert(<-done == nil, "first call should succeed")
+
+	// 反射服务公开方法选项
+	svci, _ := s.ServiceMap.Load("FBoo")
+	for _, mi := range serviceInfo(svci.(*Service)).Methods {
+		switch mi.Name {
+		case "Sum":
+			_assert(mi.MaxRequestSize == 12 && mi.Idempotent && mi.LogLevel == "debug", "unexpected method info %v", mi)
+		case "Sleep":
+			_assert(mi.MaxConcurrency == 1 && mi.TimeoutMillis == 0, "unexpected method info %v", mi)
+		}
+	}
+
+	// 替换实现后选项保留
+	if err = s.Replace(&test_service.FBoo{}); err != nil {
+		t.Fatal(err)
+	}
+	_assert(s.mustMethod("FBoo.Sum").Options().MaxRequestSize == 12, "options lost after replace")
+}
+
+func TestServer_MethodOptionsInvalid(t *testing.T) {
+	s := newTestServer(t)
+	err := s.RegisterName("", &test_service.FBoo{}, RegisterConfig{Methods: map[string]option.MethodOptions{"Missing": {}}})
+	_assert(err != nil, "expect error for unknown method")
+	err = s.RegisterName("", &test_service.FBoo{}, RegisterConfig{Methods: map[string]option.MethodOptions{"Sum": {LogLevel: "loud"}}})
+	_assert(err != nil, "expect error for invalid log level")
+	_, ok := s.ServiceMap.Load("FBoo")
+	_assert(!ok, "service with invalid options should not be registered")
+}
+
+// Blocker 处理方法不理会ctx，直到 unblock 关闭才返回
+type Blocker struct {
+	unblock chan struct{}
+}
+
+func (b *Blocker) Block(args *test_service.FBooArgs) *test_service.FBooReply {
+	<-b.unblock
+	return &test_service.FBooReply{}
+}
+
+func TestServer_MethodConcurrencyAbandoned(t *testing.T) {
+	b := &Blocker{unblock: make(chan struct{})}
+	s := newTestServer(t)
+	err := s.RegisterName("", b, RegisterConfig{Methods: map[string]option.MethodOptions{
+		"Block": {MaxConcurrency: 1, Timeout: 20 * time.Millisecond},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := dialTestServer(t, s)
+	var reply test_service.FBooReply
+	err = c.Call(context.Background(), "Blocker.Block", &test_service.FBooArgs{}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "timeout"), "expect timeout, got %v", err)
+
+	// 超时后方法仍在执行，名额没有释放
+	err = c.Call(context.Background(), "Blocker.Block", &test_service.FBooArgs{}, &reply)
+	_assert(err != nil && strings.Contains(err.Error(), "too many concurrent"), "expect concurrency error, got %v", err)
+	close(b.unblock)
+	mtype := s.mustMethod("Blocker.Block")
+	deadline := time.Now().Add(time.Second)
+	for !mtype.acquire() {
+		if time.Now().After(deadline) {
+			t.Fatal("slot not released after the method returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mtype.release()
+}
+
+func TestServer_MethodConcurrencyReplace(t *testing.T) {
+	s := newTestServer(t)
+	err := s.RegisterName("", &test_service.FBoo{}, RegisterConfig{Methods: map[string]option.MethodOptions{"Sleep": {MaxConcurrency: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := s.mustMethod("FBoo.Sleep")
+	_assert(old.acquire(), "first request should get the slot")
+
+	// 旧实现上仍在执行的请求继续占用名额
+	if err = s.Replace(&test_service.FBoo{}); err != nil {
+		t.Fatal(err)
+	}
+	replaced := s.mustMethod("FBoo.Sleep")
+	_assert(replaced != old, "method should be replaced")
+	_assert(!replaced.acquire(), "slot held by the old implementation should be counted")
+	old.release()
+	_assert(replaced.acquire(), "slot should be free after the old request returns")
+	replaced.release()
+}
+
+func TestServer_MethodOptionsLargeJSONBody(t *testing.T) {
+	s := newTestServer(t)
+	err := s.RegisterName("", &test_service.FBoo{}, RegisterConfig{Methods: map[string]option.MethodOptions{"Sum": {MaxRequestSize: 12}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cliConn, srvConn := net.Pipe()
+	defer cliConn.Close()
+	done := make(chan struct{})
+	go func() {
+		s.serveConn(srvConn)
+		close(done)
+	}()
+	opt := *option.DefaultOption
+	opt.CodecType = codec.JsonType
+	enc := json.NewEncoder(cliConn)
+	if err = enc.Encode(&opt); err != nil {
+		t.Fatal(err)
+	}
+	// 远超上限的请求体不会被整体读入，服务端读到上限后关闭连接
+	go func() {
+		_ = enc.Encode(&codec.Header{ServiceMethod: "FBoo.Sum", Seq: 1})
+		_ = enc.Encode(strings.Repeat("x", 1<<20))
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect server to close the connection")
+	}
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 请求状态，用作指标的 status 标签
+const (
+	statusOK               = "OK"
+	statusError            = "Error"
+	statusUnauthenticated  = "Unauthenticated"
+	statusPermissionDenied = "PermissionDenied"
+	statusDeadlineExceeded = "DeadlineExceeded"
+	statusCanceled         = "Canceled"
+	// statusResourceExhausted 方法的并发数达到 MaxConcurrency
+	statusResourceExhausted = "ResourceExhausted"
+)
+
+// unknownMethod 找不到服务或方法的请求共用的指标名，避免调用方任意的方法名产生大量指标
+const unknownMethod = "unknown.unknown"
+
+var (
+	latencyBuckets = []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	sizeBuckets    = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+)
+
+// histogram Prometheus风格的直方图，counts 不累加，输出时再累加
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// methodMetrics 单个方法的统计
+type methodMetrics struct {
+	service, method string
+	inFlight        int64
+
+	mu        sync.Mutex
+	statuses  map[string]uint64
+	latency   *histogram
+	reqBytes  *histogram
+	respBytes *histogram
+}
+
+// serverMetrics Server的全部指标
+type serverMetrics struct {
+	methods sync.Map // Service.Method -> *methodMetrics
+
+	connections      int64  // 当前连接数
+	connectionsTotal uint64 // 累计连接数
+
+	mu                sync.Mutex
+	handshakeFailures map[string]uint64 // 原因 -> 次数
+	rejections        map[string]uint64 // 连接被拒绝的原因 -> 次数
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{handshakeFailures: make(map[string]uint64), rejections: make(map[string]uint64)}
+}
+
+func (m *serverMetrics) method(serviceMethod string) *methodMetrics {
+	if mm, ok := m.methods.Load(serviceMethod); ok {
+		return mm.(*methodMetrics)
+	}
+	dot := strings.LastIndex(serviceMethod, ".")
+	mm, _ := m.methods.LoadOrStore(serviceMethod, &methodMetrics{
+		service:   serviceMethod[:dot],
+		method:    serviceMethod[dot+1:],
+		statuses:  make(map[string]uint64),
+		latency:   newHistogram(latencyBuckets),
+		reqBytes:  newHistogram(sizeBuckets),
+		respBytes: newHistogram(sizeBuckets),
+	})
+	return mm.(*methodMetrics)
+}
+
+// begin 请求开始处理
+func (m *serverMetrics) begin(serviceMethod string) {
+	atomic.AddInt64(&m.method(serviceMethod).inFlight, 1)
+}
+
+// end 请求处理完成
+func (m *serverMetrics) end(serviceMethod, status string, latency time.Duration, reqBytes, respBytes int32) {
+	mm := m.method(serviceMethod)
+	mm.mu.Lock()
+	mm.statuses[status]++
+	mm.latency.observe(latency.Seconds())
+	mm.reqBytes.observe(float64(reqBytes))
+	mm.respBytes.observe(float64(respBytes))
+	mm.mu.Unlock()
+	atomic.AddInt64(&mm.inFlight, -1)
+}
+
+// metricsMethod 请求计入指标时使用的方法名，与调试页面一致使用实际执行的 Service@version.Method
+func (req *request) metricsMethod() string {
+	if req.mtype == nil {
+		return unknownMethod
+	}
+	return req.method()
+}
+
+// rejectRequest 请求在执行方法前被拒绝，如找不到方法、参数无法解码、超过大小限制，同样计入指标和访问日志
+func (s *Server) rejectRequest(req *request, err error, start time.Time, respBytes int32) {
+	status := statusError
+	if errors.Is(err, errRequestTooLarge) {
+		status = statusResourceExhausted
+	}
+	s.metrics.begin(req.metricsMethod())
+	s.finishRequest(req, status, start, respBytes)
+}
+
+// methodStats 调试页面使用的单个方法统计
+type methodStats struct {
+	calls, errors uint64
+	inFlight      int64
+	avgLatency    time.Duration
+}
+
+func (m *serverMetrics) stats(serviceMethod string) methodStats {
+	v, ok := m.methods.Load(serviceMethod)
+	if !ok {
+		return methodStats{}
+	}
+	mm := v.(*methodMetrics)
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	st := methodStats{
+		calls:    mm.latency.count,
+		errors:   mm.latency.count - mm.statuses[statusOK],
+		inFlight: atomic.LoadInt64(&mm.inFlight),
+	}
+	if st.calls > 0 {
+		st.avgLatency = time.Duration(mm.latency.sum / float64(st.calls) * float64(time.Second))
+	}
+	return st
+}
+
+func (m *serverMetrics) connOpened() {
+	atomic.AddInt64(&m.connections, 1)
+	atomic.AddUint64(&m.connectionsTotal, 1)
+}
+
+func (m *serverMetrics) connClosed() {
+	atomic.AddInt64(&m.connections, -1)
+}
+
+func (m *serverMetrics) handshakeFailed(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handshakeFailures[reason]++
+}
+
+func (m *serverMetrics) connRejected(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejections[reason]++
+}
+
+// WriteTo 以Prometheus文本格式输出
+func (m *serverMetrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	var methods []*methodMetrics
+	m.methods.Range(func(_, v interface{}) bool {
+		methods = append(methods, v.(*methodMetrics))
+		return true
+	})
+	sort.Slice(methods, func(i, j int) bool {
+		if methods[i].service != methods[j].service {
+			return methods[i].service < methods[j].service
+		}
+		return methods[i].method < methods[j].method
+	})
+
+	writeHeader(&b, "anbrpc_server_requests_total", "counter", "Total number of RPC requests handled, by status.")
+	for _, mm := range methods {
+		mm.mu.Lock()
+		statuses := make([]string, 0, len(mm.statuses))
+		for st := range mm.statuses {
+			statuses = append(statuses, st)
+		}
+		sort.Strings(statuses)
+		for _, st := range statuses {
+			fmt.Fprintf(&b, "anbrpc_server_requests_total{%s,status=%q} %d\n", mm.labels(), st, mm.statuses[st])
+		}
+		mm.mu.Unlock()
+	}
+	writeHeader(&b, "anbrpc_server_in_flight_requests", "gauge", "Number of RPC requests currently being handled.")
+	for _, mm := range methods {
+		fmt.Fprintf(&b, "anbrpc_server_in_flight_requests{%s} %d\n", mm.labels(), atomic.LoadInt64(&mm.inFlight))
+	}
+	histograms := []struct {
+		name, help string
+		get        func(*methodMetrics) *histogram
+	}{
+		{"anbrpc_server_request_duration_seconds", "RPC request handling latency in seconds.", func(mm *methodMetrics) *histogram { return mm.latency }},
+		{"anbrpc_server_request_bytes", "RPC request body size in bytes.", func(mm *methodMetrics) *histogram { return mm.reqBytes }},
+		{"anbrpc_server_response_bytes", "RPC response body size in bytes.", func(mm *methodMetrics) *histogram { return mm.respBytes }},
+	}
+	for _, hm := range histograms {
+		writeHeader(&b, hm.name, "histogram", hm.help)
+		for _, mm := range methods {
+			mm.mu.Lock()
+			writeHistogram(&b, hm.name, mm.labels(), hm.get(mm))
+			mm.mu.Unlock()
+		}
+	}
+
+	writeHeader(&b, "anbrpc_server_connections", "gauge", "Number of open connections.")
+	fmt.Fprintf(&b, "anbrpc_server_connections %d\n", atomic.LoadInt64(&m.connections))
+	writeHeader(&b, "anbrpc_server_connections_total", "counter", "Total number of accepted connections.")
+	fmt.Fprintf(&b, "anbrpc_server_connections_total %d\n", atomic.LoadUint64(&m.connectionsTotal))
+	writeHeader(&b, "anbrpc_server_handshake_failures_total", "counter", "Total number of failed connection handshakes, by reason.")
+	m.mu.Lock()
+	writeReasons(&b, "anbrpc_server_handshake_failures_total", m.handshakeFailures)
+	writeHeader(&b, "anbrpc_server_connections_rejected_total", "counter", "Total number of connections rejected by connection limits, by reason.")
+	writeReasons(&b, "anbrpc_server_connections_rejected_total", m.rejections)
+	m.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (mm *methodMetrics) labels() string {
+	return fmt.Sprintf("service=%q,method=%q", mm.service, mm.method)
+}
+
+func writeHeader(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeReasons(b *strings.Builder, name string, counts map[string]uint64) {
+	reasons := make([]string, 0, len(counts))
+	for r := range counts {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		fmt.Fprintf(b, "%s{reason=%q} %d\n", name, r, counts[r])
+	}
+}
+
+func writeHistogram(b *strings.Builder, name, labels string, h *histogram) {
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{%s,le=%q} %d\n", name, labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(b, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+type metricsHTTP struct {
+	*Server
+}
+
+// Runs at /metrics
+func (server metricsHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = server.metrics.WriteTo(w)
+}
+
+// MetricsHandler 返回Prometheus文本格式的指标Handler，可挂到自定义的ServeMux上
+func (s *Server) MetricsHandler() http.Handler {
+	return metricsHTTP{s}
+}
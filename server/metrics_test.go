@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	c := dialTestServer(t, s)
+	var reply test_service.FBooReply
+	// 找不到方法的请求在读协程中记录，先于之后的请求
+	_ = c.Call(context.Background(), "FBoo.Missing", &test_service.FBooArgs{}, &reply)
+	for i := 0; i < 3; i++ {
+		if err := c.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 响应先于统计写入，等待请求全部结束
+	for atomic.LoadInt64(&s.metrics.method("FBoo.Sum").inFlight) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// 握手失败
+	cliConn, srvConn := net.Pipe()
+	go func() {
+		_, _ = cliConn.Write([]byte("not json"))
+		_ = cliConn.Close()
+	}()
+	s.serveConn(srvConn)
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`anbrpc_server_requests_total{service="FBoo",method="Sum",status="OK"} 3`,
+		`anbrpc_server_in_flight_requests{service="FBoo",method="Sum"} 0`,
+		`anbrpc_server_requests_total{service="unknown",method="unknown",status="Error"} 1`,
+		`anbrpc_server_request_duration_seconds_count{service="FBoo",method="Sum"} 3`,
+		`anbrpc_server_response_bytes_bucket{service="FBoo",method="Sum",le="+Inf"} 3`,
+		`anbrpc_server_connections 1`,
+		`anbrpc_server_connections_total 2`,
+		`anbrpc_server_handshake_failures_total{reason="decode_option"} 1`,
+		"# TYPE anbrpc_server_request_bytes histogram",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/metadata"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+// Recorder 记录收到的事件和请求ID
+type Recorder struct {
+	events chan int32
+	ids    chan string
+}
+
+func (r *Recorder) Record(ctx context.Context, args *test_service.FBooArgs) *test_service.FBooReply {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.ids <- md.Get(RequestIDKey)
+	r.events <- args.Num1
+	return &test_service.FBooReply{Num: args.Num1}
+}
+
+func TestClient_Notify(t *testing.T) {
+	r := &Recorder{events: make(chan int32, 1), ids: make(chan string, 1)}
+	s := newTestServer(t, r, &Counter{})
+	c := dialTestServer(t, s)
+
+	// 单向调用同样带上ctx中的元数据
+	ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDKey, "req-7")
+	if err := c.Notify(ctx, "Recorder.Record", &test_service.FBooArgs{Num1: 7}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-r.events:
+		_assert(n == 7, "unexpected event %d", n)
+		_assert(<-r.ids == "req-7", "expect request id from ctx")
+	case <-time.After(time.Second):
+		t.Fatal("one-way call not handled")
+	}
+	// 找不到方法的单向调用同样没有响应
+	if err := c.Notify(context.Background(), "Recorder.Missing", &test_service.FBooArgs{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 单向调用的响应不会被发送，连接上的后续调用不受影响
+	var reply test_service.FBooReply
+	if err := c.Call(context.Background(), "Counter.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 3, "unexpected reply %v", reply.Num)
+	waitIdle(t, s, "Recorder.Record")
+	st := s.metrics.stats("Recorder.Record")
+	_assert(st.calls == 1 && st.errors == 0, "unexpected stats %+v", st)
+}
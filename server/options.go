@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ServerOption NewServer 的可选配置
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	logger           *zap.Logger
+	log              logger.Config
+	maxConns         int
+	maxConnsPerIP    int
+	handshakeTimeout time.Duration
+	listener         net.Listener
+}
+
+// WithLogger 使用调用方的Logger，设置后忽略其他日志配置
+func WithLogger(lg *zap.Logger) ServerOption {
+	return func(o *serverOptions) {
+		o.logger = lg
+	}
+}
+
+// WithLogLevel 最低日志级别，默认 Info
+func WithLogLevel(level zapcore.Level) ServerOption {
+	return func(o *serverOptions) {
+		o.log.Level = level
+	}
+}
+
+// WithLogPath 日志写入文件，默认输出到标准错误
+func WithLogPath(path string) ServerOption {
+	return func(o *serverOptions) {
+		o.log.Path = path
+	}
+}
+
+// WithLogFormat 日志格式 logger.FormatJSON 或 logger.FormatConsole
+func WithLogFormat(format string) ServerOption {
+	return func(o *serverOptions) {
+		o.log.Format = format
+	}
+}
+
+// WithMaxConns 最大连接数，超过时新连接直接关闭，0表示不限制
+func WithMaxConns(n int) ServerOption {
+	return func(o *serverOptions) {
+		o.maxConns = n
+	}
+}
+
+// WithMaxConnsPerIP 每个远端IP的最大连接数，0表示不限制
+func WithMaxConnsPerIP(n int) ServerOption {
+	return func(o *serverOptions) {
+		o.maxConnsPerIP = n
+	}
+}
+
+// WithHandshakeTimeout 等待客户端发送Option的最长时间，默认 DefaultHandshakeTimeout
+func WithHandshakeTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.handshakeTimeout = d
+	}
+}
+
+// buildLogger 按配置创建Server的Logger，配置无效时退回到标准错误
+func (o *serverOptions) buildLogger() *zap.Logger {
+	if o.logger != nil {
+		return o.logger
+	}
+	lg, err := logger.New(o.log)
+	if err != nil {
+		lg, _ = logger.New(logger.Config{Level: o.log.Level})
+		lg.Warn("invalid log config, fall back to stderr", zap.Error(err))
+	}
+	return lg
+}
+
+// WithListener 使用调用方的Listener，如 memconn.Listener，此时忽略 NewServer 的address
+func WithListener(lis net.Listener) ServerOption {
+	return func(o *serverOptions) {
+		o.listener = lis
+	}
+}
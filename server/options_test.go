@@ -0,0 +1,43 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/logger"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNewServer_WithLogger(t *testing.T) {
+	global := zap.L()
+	core, logs := observer.New(zapcore.InfoLevel)
+	s := NewServer("127.0.0.1:0", WithLogger(zap.New(core)))
+	defer s.Close()
+
+	var foo test_service.FBoo
+	if _, err := s._register(&foo); err != nil {
+		t.Fatal(err)
+	}
+	_assert(logs.FilterMessage("rpc server: register method").Len() > 0, "register logs should go to the injected logger")
+	_assert(zap.L() == global, "NewServer should not replace the global logger")
+}
+
+func TestNewServer_LogConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpc.log")
+	s := NewServer("127.0.0.1:0", WithLogPath(path), WithLogLevel(zapcore.WarnLevel), WithLogFormat(logger.FormatJSON))
+	defer s.Close()
+	s.logger.Info("dropped")
+	s.logger.Warn("kept")
+	_ = s.logger.Sync()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_assert(!strings.Contains(string(b), "dropped") && strings.Contains(string(b), `"msg":"kept"`), "unexpected log file %s", b)
+}
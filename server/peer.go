@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/auth"
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/option"
+)
+
+// Peer 调用方的信息，处理方法通过 PeerFromContext 获取，可用于按客户端限额、审计日志等
+// 同一连接上的请求共用 Option，处理方法不应修改
+type Peer struct {
+	ConnID      uint64               // 连接ID，与调试页面中的一致；HTTP网关、gRPC等不经过连接的请求为0
+	Addr        string               // 对端地址
+	Codec       codec.Type           // 协商的编码类型
+	Option      *option.Option       // 握手时客户端发送的Option，没有握手的请求（JSON-RPC、HTTP网关、gRPC）为nil
+	Identity    *auth.Identity       // 通过认证的调用方身份，未开启认证时为nil
+	TLS         *tls.ConnectionState // TLS连接的状态，不是TLS连接时为nil
+	ConnectedAt time.Time            // 连接建立的时间，不经过连接的请求为收到请求的时间
+}
+
+type peerKey struct{}
+
+// PeerFromContext 在处理方法中获取调用方的信息
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+func withPeer(ctx context.Context, p *Peer) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// connPeer 连接上所有请求共同的信息，在握手之后获取，此时TLS握手已经完成
+func (ci *connInfo) connPeer(opt *option.Option) Peer {
+	p := Peer{ConnID: ci.id, Addr: ci.peer, Codec: opt.CodecType, TLS: connTLS(ci.rw.ReadWriteCloser), ConnectedAt: ci.start}
+	// JSON-RPC连接没有握手，Option是服务端的默认值
+	if opt.CodecType != codec.JSONRPCType {
+		p.Option = opt
+	}
+	return p
+}
+
+// connTLS TLS连接的状态，WebSocket连接取HTTP请求的TLS状态
+func connTLS(conn io.ReadWriteCloser) *tls.ConnectionState {
+	switch c := conn.(type) {
+	case *tls.Conn:
+		state := c.ConnectionState()
+		return &state
+	case wsConn:
+		return c.Request().TLS
+	}
+	return nil
+}
+
+// httpPeer 不经过连接的HTTP请求的调用方信息
+func httpPeer(r *http.Request, t codec.Type) *Peer {
+	return &Peer{Addr: r.RemoteAddr, Codec: t, TLS: r.TLS, ConnectedAt: time.Now()}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/auth"
+	"github.com/yx-Anbf1a/anbrpc/client"
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+// PeerRecorder 记录最近一次调用方的信息
+type PeerRecorder struct {
+	mu   sync.Mutex
+	last *Peer
+}
+
+func (r *PeerRecorder) Sum(ctx context.Context, args *test_service.FBooArgs) *test_service.FBooReply {
+	p, _ := PeerFromContext(ctx)
+	r.mu.Lock()
+	r.last = p
+	r.mu.Unlock()
+	return &test_service.FBooReply{Num: args.Num1 + args.Num2}
+}
+
+func (r *PeerRecorder) peer() *Peer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+func TestServer_Peer(t *testing.T) {
+	rec := &PeerRecorder{}
+	s := newTestServer(t, rec)
+	s.WithAuth(auth.NewTokenAuthenticator(map[string]*auth.Identity{
+		"alice-token": {Principal: "alice"},
+	}), nil)
+
+	c := dialTestServer(t, s)
+	c.WithCredentials(client.BearerToken("alice-token"))
+	var reply test_service.FBooReply
+	if err := c.Call(context.Background(), "PeerRecorder.Sum", &test_service.FBooArgs{Num1: 1}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	p := rec.peer()
+	_assert(p != nil, "handler got no peer")
+	_assert(p.ConnID != 0 && p.Addr == "pipe" && p.Codec == codec.ProtoTyp, "unexpected peer %+v", p)
+	_assert(p.Option != nil && p.Option.CodecType == codec.ProtoTyp, "expect handshake option, got %+v", p.Option)
+	_assert(p.Identity != nil && p.Identity.Principal == "alice", "expect identity alice, got %+v", p.Identity)
+	_assert(p.TLS == nil, "pipe is not a TLS connection")
+
+	// 同一连接上的请求共用连接ID
+	connID := p.ConnID
+	if err := c.Call(context.Background(), "PeerRecorder.Sum", &test_service.FBooArgs{Num1: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(rec.peer() != p && rec.peer().ConnID == connID, "expect a new peer on the same connection")
+
+	// 不经过连接的请求
+	r := httptest.NewRequest(http.MethodPost, "/rpc/PeerRecorder/Sum", strings.NewReader(`{"Num1":1}`))
+	r.Header.Set("Authorization", "Bearer alice-token")
+	w := httptest.NewRecorder()
+	s.GatewayHandler("").ServeHTTP(w, r)
+	_assert(w.Code == http.StatusOK, "expect 200, got %d %s", w.Code, w.Body)
+	p = rec.peer()
+	_assert(p.ConnID == 0 && p.Addr == r.RemoteAddr && p.Option == nil && p.Codec == codec.JsonType, "unexpected gateway peer %+v", p)
+	_assert(p.Identity != nil && p.Identity.Principal == "alice", "expect identity alice, got %+v", p.Identity)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"reflect"
+	"sort"
+
+	pb "github.com/yx-Anbf1a/anbrpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// ReflectionServiceName 内置反射服务的服务名
+const ReflectionServiceName = "Reflection"
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// Reflection 内置反射服务，列出 ServiceMap 中的服务、方法和消息结构
+// 工具可以据此发现服务，并借助 dynamicpb 在没有stub的情况下调用
+type Reflection struct {
+	s *Server
+}
+
+// ListServices 列出所有服务及方法
+func (r *Reflection) ListServices(args *pb.ListServicesRequest) *pb.ListServicesResponse {
+	reply := new(pb.ListServicesResponse)
+	r.s.ServiceMap.Range(func(_, svci interface{}) bool {
+		reply.Services = append(reply.Services, serviceInfo(svci.(*Service)))
+		return true
+	})
+	sort.Slice(reply.Services, func(i, j int) bool {
+		return reply.Services[i].Name < reply.Services[j].Name
+	})
+	return reply
+}
+
+// FileDescriptors 返回服务或消息所在的proto文件描述及其全部依赖
+func (r *Reflection) FileDescriptors(args *pb.FileDescriptorsRequest) *pb.FileDescriptorsResponse {
+	reply := new(pb.FileDescriptorsResponse)
+	var files []protoreflect.FileDescriptor
+	if args.Service != "" {
+		if svci, ok := r.s.ServiceMap.Load(args.Service); ok {
+			for _, name := range sortedMethodNames(svci.(*Service)) {
+				m := svci.(*Service).method[name]
+				for _, t := range []reflect.Type{m.ArgType, m.ReplyType} {
+					if md := messageDescriptor(t); md != nil {
+						files = append(files, md.ParentFile())
+					}
+				}
+			}
+		}
+	}
+	if args.Message != "" {
+		if d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(args.Message)); err == nil {
+			files = append(files, d.ParentFile())
+		}
+	}
+
+	seen := make(map[string]bool)
+	var walk func(fd protoreflect.FileDescriptor)
+	walk = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			walk(imports.Get(i).FileDescriptor)
+		}
+		b, err := proto.Marshal(protodesc.ToFileDescriptorProto(fd))
+		if err != nil {
+			return
+		}
+		reply.FileDescriptors = append(reply.FileDescriptors, b)
+	}
+	for _, fd := range files {
+		walk(fd)
+	}
+	return reply
+}
+
+func serviceInfo(svc *Service) *pb.ServiceInfo {
+	info := &pb.ServiceInfo{Name: svc.name}
+	for _, name := range sortedMethodNames(svc) {
+		m := svc.method[name]
+		mi := &pb.MethodInfo{
+			Name:            name,
+			ArgType:         m.ArgType.String(),
+			ReplyType:       m.ReplyType.String(),
+			ServerStreaming: m.ServerStreaming,
+			ClientStreaming: m.ClientStreaming,
+			TimeoutMillis:   m.opts.Timeout.Milliseconds(),
+			MaxRequestSize:  m.opts.MaxRequestSize,
+			Idempotent:      m.opts.Idempotent,
+			MaxConcurrency:  int32(m.opts.MaxConcurrency),
+			LogLevel:        m.opts.LogLevel,
+		}
+		if md := messageDescriptor(m.ArgType); md != nil {
+			mi.ArgMessage = string(md.FullName())
+		}
+		if md := messageDescriptor(m.ReplyType); md != nil {
+			mi.ReplyMessage = string(md.FullName())
+		}
+		info.Methods = append(info.Methods, mi)
+	}
+	return info
+}
+
+func sortedMethodNames(svc *Service) []string {
+	names := make([]string, 0, len(svc.method))
+	for name := range svc.method {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// messageDescriptor 类型实现了proto.Message时返回其消息描述
+func messageDescriptor(t reflect.Type) protoreflect.MessageDescriptor {
+	if t.Kind() != reflect.Ptr || !t.Implements(protoMessageType) {
+		return nil
+	}
+	return reflect.New(t.Elem()).Interface().(proto.Message).ProtoReflect().Descriptor()
+}
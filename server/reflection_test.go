@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/yx-Anbf1a/anbrpc/reflection"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestReflection(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	c := dialTestServer(t, s)
+
+	var list pb.ListServicesResponse
+	if err := c.Call(context.Background(), "Reflection.ListServices", &pb.ListServicesRequest{}, &list); err != nil {
+		t.Fatal(err)
+	}
+	_assert(len(list.Services) == 3, "expect FBoo, Health and Reflection, got %v", list.Services)
+	fboo := list.Services[0]
+	_assert(fboo.Name == "FBoo" && len(fboo.Methods) == 2, "unexpected service %v", fboo)
+	sum := fboo.Methods[1]
+	_assert(sum.Name == "Sum" && sum.ArgMessage == "test_service.FBooArgs" && sum.ReplyMessage == "test_service.FBooReply",
+		"unexpected method %v", sum)
+
+	// 只凭描述符构造动态消息完成调用
+	var fds pb.FileDescriptorsResponse
+	if err := c.Call(context.Background(), "Reflection.FileDescriptors", &pb.FileDescriptorsRequest{Service: "FBoo"}, &fds); err != nil {
+		t.Fatal(err)
+	}
+	files := new(protoregistry.Files)
+	for _, b := range fds.FileDescriptors {
+		fdp := new(descriptorpb.FileDescriptorProto)
+		if err := proto.Unmarshal(b, fdp); err != nil {
+			t.Fatal(err)
+		}
+		fd, err := protodesc.NewFile(fdp, files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = files.RegisterFile(fd)
+	}
+	argDesc, err := files.FindDescriptorByName(protoreflect.FullName(sum.ArgMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replyDesc, _ := files.FindDescriptorByName(protoreflect.FullName(sum.ReplyMessage))
+	args := dynamicpb.NewMessage(argDesc.(protoreflect.MessageDescriptor))
+	args.Set(args.Descriptor().Fields().ByName("Num1"), protoreflect.ValueOfInt32(3))
+	args.Set(args.Descriptor().Fields().ByName("Num2"), protoreflect.ValueOfInt32(4))
+	reply := dynamicpb.NewMessage(replyDesc.(protoreflect.MessageDescriptor))
+	if err = c.Call(context.Background(), "FBoo.Sum", args, reply); err != nil {
+		t.Fatal(err)
+	}
+	num := reply.Get(reply.Descriptor().Fields().ByName("Num")).Int()
+	_assert(num == 7, "expect 7, got %d", num)
+}
@@ -3,9 +3,11 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/yx-Anbf1a/anbrpc/option"
 	"go.etcd.io/etcd/clientv3"
 	"go.uber.org/zap"
-	"log"
+	"sync"
 	"time"
 )
 
@@ -14,6 +16,8 @@ type RegisterConfig struct {
 	ServiceName string // Key
 	Host        string // Value
 	Lease       int64
+	// Methods 按方法名设置的选项，注册时生效，并随节点的值写入注册中心
+	Methods map[string]option.MethodOptions
 }
 
 type ServiceRegister struct {
@@ -21,13 +25,27 @@ type ServiceRegister struct {
 	leaseID clientv3.LeaseID //租约ID
 	//租约keepalieve相应chan
 	keepAliveChan <-chan *clientv3.LeaseKeepAliveResponse
-	key           string //key
-	val           string //value
 	logger        *zap.Logger
+
+	mu      sync.Mutex
+	entries map[string]*registryEntry // key -> 节点, 所有节点共用一个租约
+}
+
+// registryEntry 注册中心中的一个节点
+type registryEntry struct {
+	key     string //key
+	val     string //value
+	service string // 对应的rpc服务名，为空表示整个Server
+	serving bool   // key当前是否在etcd中
 }
 
-// NewServiceRegister 新建注册服务
+// NewServiceRegister 新建注册服务，不输出日志，由Server创建时使用Server的logger
 func NewServiceRegister(config RegisterConfig) (*ServiceRegister, error) {
+	return newServiceRegister(config, "", zap.NewNop())
+}
+
+// newServiceRegister 申请租约并注册第一个节点，service为该节点对应的rpc服务名
+func newServiceRegister(config RegisterConfig, service string, lg *zap.Logger) (*ServiceRegister, error) {
 	if config.Host == "" || config.ServiceName == "" || len(config.Endpoints) == 0 {
 		return nil, errors.New("请填入正确RegisterConfig参数")
 	}
@@ -39,43 +57,98 @@ func NewServiceRegister(config RegisterConfig) (*ServiceRegister, error) {
 		DialTimeout: 5 * time.Second,
 	})
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	ser := &ServiceRegister{
-		cli: cli,
-		key: config.ServiceName,
-		val: config.Host,
+		cli:     cli,
+		logger:  lg,
+		entries: make(map[string]*registryEntry),
 	}
 
 	//申请租约设置时间keepalive
-	if err = ser.putKeyWithLease(config.Lease); err != nil {
+	if err = ser.grantLease(config.Lease); err != nil {
+		_ = cli.Close()
+		return nil, err
+	}
+	if err = ser.Put(config.ServiceName, config.Host, service); err != nil {
+		// 撤销租约，不留下没有节点的租约
+		_ = ser.Close()
 		return nil, err
 	}
 	return ser, nil
 }
 
 // 设置租约
-func (s *ServiceRegister) putKeyWithLease(lease int64) error {
+func (s *ServiceRegister) grantLease(lease int64) error {
 	//设置租约时间
 	resp, err := s.cli.Grant(context.Background(), lease)
 	if err != nil {
 		return err
 	}
-	//注册服务并绑定租约
-	_, err = s.cli.Put(context.Background(), s.key, s.val, clientv3.WithLease(resp.ID))
-	if err != nil {
-		return err
-	}
 	//设置续租 定期发送需求请求
 	leaseRespChan, err := s.cli.KeepAlive(context.Background(), resp.ID)
 
 	if err != nil {
+		_, _ = s.cli.Revoke(context.Background(), resp.ID)
 		return err
 	}
 	s.leaseID = resp.ID
-	log.Println(s.leaseID)
+	s.logger.Info("grant lease", zap.Int64("lease", int64(s.leaseID)))
 	s.keepAliveChan = leaseRespChan
-	log.Printf("Put key:%s  val:%s  success!", s.key, s.val)
+	return nil
+}
+
+// Put 在同一个租约下注册一个节点，service为该节点对应的rpc服务名
+// key已经属于另一个服务时返回错误，不覆盖它的节点
+func (s *ServiceRegister) Put(key, val, service string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.service != service {
+		return fmt.Errorf("registry: key %s already registered for service %q", key, e.service)
+	}
+	//注册服务并绑定租约
+	_, err := s.cli.Put(context.Background(), key, val, clientv3.WithLease(s.leaseID))
+	if err != nil {
+		return err
+	}
+	s.entries[key] = &registryEntry{key: key, val: val, service: service, serving: true}
+	s.logger.Info("put registry key success", zap.String("key", key), zap.String("val", val))
+	return nil
+}
+
+// services 返回 key -> rpc服务名
+func (s *ServiceRegister) services() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	services := make(map[string]string, len(s.entries))
+	for key, e := range s.entries {
+		services[key] = e.service
+	}
+	return services
+}
+
+// SetServing 服务不健康时从etcd中删除key，恢复后用同一个租约重新写入
+func (s *ServiceRegister) SetServing(key string, serving bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return errors.New("registry: unknown key " + key)
+	}
+	if e.serving == serving {
+		return nil
+	}
+	var err error
+	if serving {
+		_, err = s.cli.Put(context.Background(), e.key, e.val, clientv3.WithLease(s.leaseID))
+	} else {
+		_, err = s.cli.Delete(context.Background(), e.key)
+	}
+	if err != nil {
+		return err
+	}
+	e.serving = serving
+	s.logger.Info("update registry serving status", zap.String("key", e.key), zap.Bool("serving", serving))
 	return nil
 }
 
@@ -89,7 +162,7 @@ func (s *ServiceRegister) ListenLeaseRespChan() {
 	s.logger.Info("关闭续租")
 }
 
-// Close 注销服务
+// Close 注销服务，撤销租约后所有节点一起从etcd中删除
 func (s *ServiceRegister) Close() error {
 	//撤销租约
 	if _, err := s.cli.Revoke(context.Background(), s.leaseID); err != nil {
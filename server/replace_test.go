@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+// FBoo 与 test_service.FBoo 同名，用来替换服务实现
+type FBoo struct {
+	base int32
+}
+
+func (f *FBoo) Sum(args *test_service.FBooArgs) *test_service.FBooReply {
+	return &test_service.FBooReply{Num: f.base + args.Num1 + args.Num2}
+}
+
+func TestServer_ReplaceAndUnregister(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	c := dialTestServer(t, s)
+	var reply test_service.FBooReply
+	args := &test_service.FBooArgs{Num1: 1, Num2: 2}
+
+	if err := s.Replace(&FBoo{base: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call(context.Background(), "FBoo.Sum", args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 103, "expect replaced implementation, got %d", reply.Num)
+
+	var unknown Foo
+	if err := s.Replace(&unknown); err == nil {
+		t.Fatal("expect error replacing an unknown service")
+	}
+	if err := s.Unregister("FBoo"); err != nil {
+		t.Fatal(err)
+	}
+	_assert(s.Unregister("FBoo") != nil, "expect error unregistering twice")
+	_assert(s.ServingStatus("FBoo").String() == "SERVICE_UNKNOWN", "health status should be removed")
+	if err := c.Call(context.Background(), "FBoo.Sum", args, &reply); err == nil {
+		t.Fatal("expect error calling an unregistered service")
+	}
+}
+
+func TestServer_RegisterName(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.RegisterName("Calc", &FBoo{base: 10}, RegisterConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterName("Calc2", &FBoo{base: 20}, RegisterConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	_assert(s.RegisterName("Calc", &FBoo{}, RegisterConfig{}) != nil, "expect duplicate name error")
+	c := dialTestServer(t, s)
+	var reply test_service.FBooReply
+	args := &test_service.FBooArgs{Num1: 1, Num2: 2}
+	for name, want := range map[string]int32{"Calc": 13, "Calc2": 23} {
+		if err := c.Call(context.Background(), name+".Sum", args, &reply); err != nil {
+			t.Fatal(err)
+		}
+		_assert(reply.Num == want, "%s: expect %d, got %d", name, want, reply.Num)
+	}
+	if err := s.ReplaceName("Calc", &FBoo{base: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call(context.Background(), "Calc.Sum", args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 33, "expect 33, got %d", reply.Num)
+}
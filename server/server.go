@@ -1,15 +1,24 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/yx-Anbf1a/anbrpc/auth"
 	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/discovery"
+	healthpb "github.com/yx-Anbf1a/anbrpc/health"
+	"github.com/yx-Anbf1a/anbrpc/idempotency"
+	"github.com/yx-Anbf1a/anbrpc/internal/keepalive"
 	"github.com/yx-Anbf1a/anbrpc/logger"
+	"github.com/yx-Anbf1a/anbrpc/metadata"
 	"github.com/yx-Anbf1a/anbrpc/option"
+	"github.com/yx-Anbf1a/anbrpc/tracing"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"reflect"
@@ -25,20 +34,70 @@ type Server struct {
 	l          net.Listener
 	mu         sync.Mutex
 	logger     *zap.Logger
+	authn      auth.Authenticator // 每次调用的凭证校验
+	authz      *auth.Authorizer   // 方法级授权策略
+	health     *Health
+	metrics    *serverMetrics
+	conns      sync.Map          // 存活连接 id -> *connInfo
+	idem       *idempotencyGuard // 幂等键，为nil时不开启
+	keepalive  option.KeepaliveParams
+	limiter    *connLimiter
+	tracer     tracing.Tracer // 为nil时不记录span，只传递trace
+	accessLog  *AccessLogConfig
+	// handshakeTimeout 等待客户端发送Option的最长时间，0表示不限制
+	handshakeTimeout time.Duration
 }
 
-func NewServer(address string) *Server {
+// DefaultHandshakeTimeout 默认的握手超时时间
+const DefaultHandshakeTimeout = time.Second * 10
 
+// NewServer 监听address，日志默认以Info级别输出到标准错误，可以通过 WithLogger 等选项配置
+func NewServer(address string, opts ...ServerOption) *Server {
+	o := &serverOptions{log: logger.Config{Level: zapcore.InfoLevel}}
+	for _, opt := range opts {
+		opt(o)
+	}
 	//server.WithRegister(r)
-	l, _ := net.Listen("tcp", address)
+	l := o.listener
+	if l == nil {
+		l, _ = net.Listen("tcp", address)
+	}
 	//r, _ := NewServiceRegister(endpoints, key, "tcp@"+l.Addr().String(), 20)
-	server := &Server{}
+	server := newServer(o.buildLogger())
+	server.limiter.maxConns = o.maxConns
+	server.limiter.maxPerIP = o.maxConnsPerIP
+	if o.handshakeTimeout > 0 {
+		server.handshakeTimeout = o.handshakeTimeout
+	}
 	server.l = l
-	server.logger, _ = logger.InitLogger("server.log", "dev")
-	server.Host = "tcp@" + l.Addr().String()
+	server.Host = l.Addr().Network() + "@" + l.Addr().String()
 	return server
 }
 
+func newServer(lg *zap.Logger) *Server {
+	s := &Server{
+		logger:    lg,
+		metrics:   newServerMetrics(),
+		keepalive: option.DefaultKeepalive,
+		limiter:   newConnLimiter(),
+
+		handshakeTimeout: DefaultHandshakeTimeout,
+	}
+	s.registerBuiltinServices()
+	return s
+}
+
+// registerBuiltinServices 自动注册内置的反射和健康检查服务
+func (s *Server) registerBuiltinServices() {
+	s.health = newHealth()
+	s.health.onChange = s.syncRegistration
+	for _, rcvr := range []interface{}{&Reflection{s: s}, s.health} {
+		if _, err := s._register(rcvr); err != nil {
+			s.logger.Error("register builtin service error", zap.Error(err))
+		}
+	}
+}
+
 var defaultServer *Server
 var once sync.Once
 
@@ -54,21 +113,73 @@ func (s *Server) Run() {
 	s.accept(s.l)
 }
 
+// Serve 在lis上接受连接直到lis关闭，lis可以是 memconn.Listener 等非TCP的Listener
+// lis替换 NewServer 时的Listener，原来的Listener被关闭，Host随之改为lis的地址
+func (s *Server) Serve(lis net.Listener) {
+	s.mu.Lock()
+	old := s.l
+	s.l = lis
+	s.Host = lis.Addr().Network() + "@" + lis.Addr().String()
+	s.mu.Unlock()
+	if old != nil && old != lis {
+		_ = old.Close()
+	}
+	s.accept(lis)
+}
+
 func (s *Server) WithRegister(register *ServiceRegister) {
 	s.register = register
 }
 
+// WithAuth 设置每次调用的身份校验和方法级授权策略，任意一个为nil时跳过对应检查
+func (s *Server) WithAuth(authn auth.Authenticator, authz *auth.Authorizer) {
+	s.authn = authn
+	s.authz = authz
+}
+
+// WithKeepalive 设置连接的保活和空闲关闭策略，默认为 option.DefaultKeepalive
+// 只设置 Interval 时 Timeout 取默认值，否则发出PING后无法发现对端已断开
+func (s *Server) WithKeepalive(params option.KeepaliveParams) {
+	if params.Interval > 0 && params.Timeout <= 0 {
+		params.Timeout = option.DefaultKeepalive.Timeout
+	}
+	s.keepalive = params
+}
+
+// Close 停止接收新连接，撤销租约，注册中心中本Server的所有节点一起删除
+func (s *Server) Close() error {
+	s.mu.Lock()
+	l := s.l
+	register := s.register
+	s.register = nil
+	s.mu.Unlock()
+	if l != nil {
+		_ = l.Close()
+	}
+	if register == nil {
+		return nil
+	}
+	return register.Close()
+}
+
 func (s *Server) accept(lis net.Listener) {
-	if s.register == nil {
+	s.mu.Lock()
+	register := s.register
+	s.mu.Unlock()
+	if register == nil {
 		//log.Println("register is nil")
 		s.logger.Error("register is nil")
 		//return
 	} else {
-		go s.register.ListenLeaseRespChan()
+		go register.ListenLeaseRespChan()
 	}
 	//defer s.register.Close()
 	for {
 		conn, err := lis.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			s.logger.Info("listener closed, stop accepting")
+			return
+		}
 		if err != nil {
 			//log.Fatal("accept error:", err)
 			s.logger.Fatal("accept error", zap.Error(err))
@@ -86,50 +197,185 @@ func (s *Server) accept(lis net.Listener) {
 	2. 根据请求头中的协议类型，处理连接
 */
 func (s *Server) serveConn(conn io.ReadWriteCloser) {
+	ip := remoteIP(conn)
+	release, reason := s.limiter.acquire(ip)
+	if reason != "" {
+		s.logger.Warn("rpc server: reject connection", zap.String("ip", ip), zap.String("reason", reason))
+		s.metrics.connRejected(reason)
+		_ = conn.Close()
+		return
+	}
+	defer release()
 
+	ci := newConnInfo(conn)
+	untrack := s.trackConn(ci)
+	s.metrics.connOpened()
 	defer func() {
 		_ = conn.Close()
+		untrack()
+		s.metrics.connClosed()
 	}()
+	// 之后的读写都经过ci.rw统计字节数
+	conn = ci.rw
+	// 对端一直不发送Option时不能永远阻塞
+	nc, _ := ci.rw.ReadWriteCloser.(net.Conn)
+	if nc != nil && s.handshakeTimeout > 0 {
+		_ = nc.SetReadDeadline(time.Now().Add(s.handshakeTimeout))
+	}
+	var raw json.RawMessage
+	dec := json.NewDecoder(conn)
+	err := dec.Decode(&raw)
+	if err == nil && codec.IsJSONRPC(raw) {
+		if nc != nil && s.handshakeTimeout > 0 {
+			_ = nc.SetReadDeadline(time.Time{})
+		}
+		// 其它语言的JSON-RPC客户端不发送Option，第一个值就是请求
+		s.serveJSONRPC(jsonrpcConn{r: io.MultiReader(bytes.NewReader(raw), dec.Buffered(), conn), ReadWriteCloser: conn}, ci)
+		return
+	}
 	var opt option.Option
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
+	if err == nil {
+		err = json.Unmarshal(raw, &opt)
+	}
+	if err != nil {
 		//log.Println("decode myRPC error:", err)
 		s.logger.Error("decode myRPC error", zap.Error(err))
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			s.metrics.handshakeFailed("handshake_timeout")
+		} else {
+			s.metrics.handshakeFailed("decode_option")
+		}
 		return
 	}
+	if nc != nil && s.handshakeTimeout > 0 {
+		_ = nc.SetReadDeadline(time.Time{})
+	}
 	s.logger.Info("receive option success", zap.Any("option", opt))
+	if opt.StreamWindow <= 0 {
+		opt.StreamWindow = option.DefaultOption.StreamWindow
+	}
 
 	if opt.MagicNumber != option.DefaultOption.MagicNumber {
 		//log.Printf("invalid magic number %x", opt.MagicNumber)
 		s.logger.Error("invalid magic number", zap.Any("opt.MagicNumber", opt.MagicNumber))
+		s.metrics.handshakeFailed("invalid_magic_number")
 		return
 	}
 	f := codec.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
 		//log.Printf("invalid codec type %s", opt.CodecType)
 		s.logger.Error("invalid codec type", zap.Any("opt.CodecType", opt.CodecType))
+		s.metrics.handshakeFailed("invalid_codec_type")
 		return
 	}
-	s.serveCodec(f(conn), &opt)
+	ci.setCodec(opt.CodecType)
+	s.serveCodec(f(conn), &opt, ci)
 }
 
 var invalidRequest = struct{}{}
 
-func (s *Server) serveCodec(cc codec.Codec, opt *option.Option) {
+func (s *Server) serveCodec(cc codec.Codec, opt *option.Option, ci *connInfo) {
 	sending := new(sync.Mutex)
+	if bl, ok := cc.(codec.BodyLimiter); ok {
+		bl.SetBodyLimit(s.maxRequestSize)
+	}
+	params := s.keepalive
+	var callback *Callback
+	if opt.CodecType == codec.JSONRPCType {
+		// JSON-RPC没有PING帧，只检测空闲；也无法发送反向调用，不提供Callback
+		params.Interval = 0
+	} else {
+		callback = newCallback(cc, sending)
+	}
+	ka := keepalive.New(params, func() error {
+		sending.Lock()
+		defer sending.Unlock()
+		return cc.Write(&codec.Header{Type: codec.FrameType_PING}, invalidRequest)
+	}, func(reason string) {
+		s.logger.Info("rpc server: close connection", zap.String("peer", ci.peer), zap.String("reason", reason))
+		_ = cc.Close()
+	}, ci.busy)
+	ci.keepalive = ka
+	ka.Start()
+	defer ka.Stop()
 	wg := new(sync.WaitGroup)
+	peer := ci.connPeer(opt)
 
 	for {
 		req, err := s.readRequest(cc)
+		arrived := time.Now()
 		if err != nil {
 			if req == nil {
 				break
 			}
 			req.h.Error = err.Error()
-			s.sendResponse(cc, req.h, invalidRequest, sending)
+			req.peer = &peer
+			s.rejectRequest(req, err, arrived, s.sendResponse(cc, req.h, invalidRequest, sending))
+			continue
+		}
+		ka.Read(req.h.Type != codec.FrameType_PING && req.h.Type != codec.FrameType_PONG)
+		switch req.h.Type {
+		case codec.FrameType_PING:
+			// 读协程不直接写，避免两端同时等待对方读取
+			go func() {
+				sending.Lock()
+				defer sending.Unlock()
+				_ = cc.Write(&codec.Header{Type: codec.FrameType_PONG}, invalidRequest)
+			}()
+			continue
+		case codec.FrameType_PONG:
+			continue
+		}
+		if req.h.Reverse {
+			if callback != nil {
+				callback.deliver(req.h, req.raw)
+			}
+			continue
+		}
+		if req.h.Type != codec.FrameType_UNARY {
+			ci.dispatchFrame(req.h, req.raw)
+			continue
+		}
+		// 流需要和客户端交互，不能单向调用
+		if req.h.OneWay && req.mtype.ServerStreaming {
+			s.requestLogger(req).Warn("rpc server: drop one-way call to stream method", zap.String("method", req.h.ServiceMethod))
 			continue
 		}
+		if req.mtype.ServerStreaming && opt.CodecType == codec.JSONRPCType {
+			req.h.Error = "rpc server: stream method " + req.h.ServiceMethod + " is not supported over JSON-RPC"
+			req.peer = &peer
+			s.rejectRequest(req, nil, arrived, s.sendResponse(cc, req.h, invalidRequest, sending))
+			continue
+		}
+		req.conn = ci
+		// 流可能长时间存在，不受HandleTimeOut限制，方法单独设置的超时优先
+		if timeout := req.mtype.timeout(opt.HandleTimeOut); timeout > 0 {
+			req.ctx, req.cancel = context.WithTimeout(context.Background(), timeout)
+		} else {
+			req.ctx, req.cancel = context.WithCancel(context.Background())
+		}
+		if callback != nil {
+			req.ctx = context.WithValue(req.ctx, callbackKey{}, callback)
+		}
+		// 每个请求一份，认证通过后填入调用方身份
+		p := peer
+		req.peer = &p
+		req.ctx = withPeer(req.ctx, req.peer)
+		req.ctx = s.startTrace(req.ctx, req, arrived)
+		// 在读协程中登记请求和流，保证取消帧和后续帧到达时能找到
+		ci.begin(req.h.Seq, req.h.ServiceMethod, req.cancel)
+		if req.mtype.ServerStreaming {
+			req.stream = newServerStream(req.ctx, s, cc, sending, req.h, opt.StreamWindow)
+			ci.addStream(req.stream)
+		}
 		wg.Add(1)
-		go s.handleRequest(cc, req, sending, wg, opt.HandleTimeOut)
+		go s.handleRequest(cc, req, sending, wg)
+	}
+	// 连接断开，取消所有请求
+	ci.cancelAll()
+	if callback != nil {
+		callback.close()
 	}
 	wg.Wait()
 	_ = cc.Close()
@@ -137,68 +383,102 @@ func (s *Server) serveCodec(cc codec.Codec, opt *option.Option) {
 
 type request struct {
 	h            *codec.Header
+	md           metadata.MD // 请求元数据
+	reqBytes     int32       // 请求体大小
+	identity     *auth.Identity
+	peer         *Peer        // 调用方信息，处理方法通过 PeerFromContext 获取
+	span         tracing.Span // 服务端span
+	queueSpan    tracing.Span // 从读出请求到开始执行的排队span，结束后为nil
 	argv, replyv reflect.Value
 	mtype        *MethodType
 	svc          *Service
+	conn         *connInfo
+	ctx          context.Context // 处理方法的context，客户端取消、超时或连接断开时被取消
+	cancel       context.CancelFunc
+	stream       *ServerStream // 流式方法的流
+	raw          []byte        // 流数据帧的原始消息体
+}
+
+// method 实际执行的方法名 Service@version.Method，不带版本的调用解析为处理它的最新版本
+func (req *request) method() string {
+	return req.svc.name + "." + req.mtype.method.Name
+}
+
+// authMethod 授权检查使用的方法名，去掉版本，同一服务的所有版本共用授权策略
+func (req *request) authMethod() string {
+	service, _ := discovery.SplitVersion(req.svc.name)
+	return service + "." + req.mtype.method.Name
 }
 
+// readRequest 读取一帧；连接空闲时一直阻塞，由keepalive检测对端是否存活
 func (s *Server) readRequest(cc codec.Codec) (*request, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	reqChan := make(chan *request, 1)
-	errChan := make(chan error, 1)
-	//req := &request{}
-	//var err error
-	go func() {
-		h, err := s.readRequestHeader(cc)
-		if err != nil {
-			//return nil, err
-			errChan <- err
-			return
-		}
-		req := &request{
-			h: h,
+	h, err := s.readRequestHeader(cc)
+	if err != nil {
+		return nil, err
+	}
+	// 流的后续帧、保活帧和反向调用的响应不是新请求，交给对应的流或 Callback 处理
+	if h.Type != codec.FrameType_UNARY || h.Reverse {
+		req := &request{h: h}
+		if req.raw, err = readFrameBody(cc, h); err != nil {
+			return nil, err
 		}
-		req.svc, req.mtype, err = s.findService(h.ServiceMethod)
-		if err != nil {
-			//return nil, err
-			errChan <- err
-			return
+		return req, nil
+	}
+	req := &request{
+		h:        h,
+		md:       metadata.MD(h.Metadata),
+		reqBytes: h.BodySize,
+	}
+	// 元数据不回传给客户端
+	h.Metadata = nil
+	req.svc, req.mtype, err = s.findService(h.ServiceMethod)
+	if err != nil {
+		// 丢弃请求体，回复错误后连接还可以继续使用
+		if err := cc.ReadBody(nil, h.BodySize); err != nil {
+			return nil, err
 		}
-		req.argv = req.mtype.newArgs()
-		req.replyv = req.mtype.newReply()
-		// 读取请求内容
-
-		// 需要用指针取读取内容
-		//if req.argv.Kind() != reflect.Ptr {
-		//	argvi = req.argv.Addr().Interface().(proto.Message)
-		//}
-		// 确保 req.argv 包含的值实现了 proto.Message 接口
-		if req.argv.Kind() != reflect.Ptr {
-			//return nil, fmt.Errorf("argument type must be a pointer to a struct implementing proto.Message")
-			errChan <- fmt.Errorf("argument type must be a pointer to a struct implementing proto.Message")
-			return
+		return req, err
+	}
+	if err = req.mtype.checkSize(h.BodySize); err != nil {
+		if err := cc.ReadBody(nil, h.BodySize); err != nil {
+			return nil, err
 		}
-		argvi := req.argv.Interface()
-		if err = cc.ReadBody(argvi, h.BodySize); err != nil {
-			//log.Println("read body error:", err)
-			s.logger.Error("read body error:", zap.Error(err))
-			//return nil, err
-			errChan <- err
-			return
+		return req, err
+	}
+	// 客户端流的参数在后续的流数据帧中
+	if req.mtype.ClientStreaming {
+		if err = cc.ReadBody(nil, h.BodySize); err != nil {
+			return nil, err
 		}
-		//return req, nil
-		reqChan <- req
-		return
-	}()
-	select {
-	case <-time.After(time.Second * 10):
-		return nil, fmt.Errorf("read Message timeout")
-	case req := <-reqChan:
 		return req, nil
-	case err := <-errChan:
+	}
+	req.argv = req.mtype.newArgs()
+	if !req.mtype.ServerStreaming {
+		req.replyv = req.mtype.newReply()
+	}
+	// 确保 req.argv 包含的值实现了 proto.Message 接口
+	if req.argv.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("argument type must be a pointer to a struct implementing proto.Message")
+	}
+	if err = cc.ReadBody(req.argv.Interface(), h.BodySize); err != nil {
+		s.requestLogger(req).Error("read body error:", zap.Error(err))
+		// 参数无法解码但帧边界完好，回复错误后连接还可以继续使用
+		if errors.Is(err, codec.ErrInvalidBody) {
+			return req, err
+		}
 		return nil, err
 	}
+	return req, nil
+}
+
+// readFrameBody 读取流帧和反向调用响应的消息体，数据帧和响应先保留原始字节，等知道类型时再解码
+func readFrameBody(cc codec.Codec, h *codec.Header) ([]byte, error) {
+	if h.Type == codec.FrameType_STREAM_DATA || h.Reverse {
+		if rc, ok := cc.(codec.RawBodyCodec); ok {
+			return rc.ReadRawBody(h.BodySize)
+		}
+	}
+	return nil, cc.ReadBody(nil, h.BodySize)
 }
 
 func (s *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
@@ -206,7 +486,7 @@ func (s *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 
 	if err := cc.ReadHeader(&h); err != nil {
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Println("read header error:", err)
+			s.logger.Error("rpc server: read header error", zap.Error(err))
 		}
 		return nil, err
 	}
@@ -223,11 +503,16 @@ func (s *Server) findService(serviceMethod string) (svc *Service, mtype *MethodT
 	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
 	// 获取服务
 	svci, ok := s.ServiceMap.Load(serviceName)
-	if !ok {
+	if ok {
+		svc = svci.(*Service)
+	} else if !strings.Contains(serviceName, discovery.VersionSeparator) {
+		// 不带版本的调用由最新的版本处理
+		svc = s.latestVersion(serviceName)
+	}
+	if svc == nil {
 		err = errors.New("rpc server: can't find service " + serviceName)
 		return
 	}
-	svc = svci.(*Service)
 	// 获取方法
 	mtype = svc.method[methodName]
 	if mtype == nil {
@@ -236,71 +521,376 @@ func (s *Server) findService(serviceMethod string) (svc *Service, mtype *MethodT
 	return
 }
 
-func (s *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
+// sendResponse 发送响应，返回响应体大小，单向调用不发送
+func (s *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) int32 {
+	if h.OneWay {
+		return 0
+	}
 	sending.Lock()
 	defer sending.Unlock()
 	if err := cc.Write(h, body); err != nil {
 		//log.Println("rpc server: write response error:", err)
 		s.logger.Error("rpc server: write response error:", zap.Error(err))
 	}
+	return h.BodySize
+}
+
+// authorize 校验调用方凭证并检查方法级授权策略
+func (s *Server) authorize(req *request) error {
+	if s.authn != nil {
+		id, err := s.authn.Authenticate(req.md)
+		if err != nil {
+			s.requestLogger(req).Warn("rpc server: authenticate failed", zap.String("method", req.h.ServiceMethod), zap.Error(err))
+			return err
+		}
+		req.identity = id
+		if req.peer != nil {
+			req.peer.Identity = id
+		}
+	}
+	if s.authz != nil {
+		if err := s.authz.Authorize(req.identity, req.authMethod()); err != nil {
+			var principal string
+			if req.identity != nil {
+				principal = req.identity.Principal
+			}
+			s.requestLogger(req).Warn("rpc server: permission denied", zap.String("method", req.h.ServiceMethod), zap.String("principal", principal))
+			return fmt.Errorf("%w: %s", err, req.h.ServiceMethod)
+		}
+	}
+	return nil
 }
 
-func (s *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
+func (s *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup) {
 	defer wg.Done()
-	called := make(chan struct{}, 1)
-	sent := make(chan struct{}, 1)
+	serviceMethod, start := req.h.ServiceMethod, time.Now()
+	status, respBytes := statusOK, int32(0)
+	seq := req.h.Seq
+	s.metrics.begin(req.metricsMethod())
+	defer func() {
+		req.cancel()
+		req.conn.end(seq)
+		// 未通过授权的流不会进入 handleStream，需要在这里注销
+		if req.stream != nil {
+			req.conn.removeStream(seq)
+		}
+		req.endTrace(status, req.h.Error)
+		s.finishRequest(req, status, start, respBytes)
+	}()
+
+	// 未通过授权的请求不执行方法
+	if err := s.authorize(req); err != nil {
+		status = authStatus(err)
+		req.h.Error = err.Error()
+		respBytes = s.sendResponse(cc, req.h, invalidRequest, sending)
+		return
+	}
+	// 处理方法通过 metadata.FromIncomingContext 读取请求元数据
+	req.ctx = metadata.NewIncomingContext(req.ctx, req.md)
+	if !req.mtype.acquire() {
+		status = statusResourceExhausted
+		req.h.Error = errTooManyRequests(serviceMethod).Error()
+		respBytes = s.sendResponse(cc, req.h, invalidRequest, sending)
+		return
+	}
+	// 并发名额在方法返回时释放，请求超时或取消后方法仍在执行时继续占用
+	releaseSlot := req.mtype.release
+	defer func() {
+		if releaseSlot != nil {
+			releaseSlot()
+		}
+	}()
+	if req.mtype.ServerStreaming {
+		req.endQueue()
+		status, respBytes = s.handleStream(req)
+		return
+	}
+	// 带幂等键的重试请求直接返回保存的响应
+	var release func(*idempotency.Response)
+	if key := s.idempotencyKey(req); key != "" {
+		resp, rel, err := s.idem.acquire(req.ctx, req.method(), key)
+		if err != nil {
+			status, respBytes = s.abandon(cc, req, sending)
+			return
+		}
+		if resp != nil {
+			status, respBytes = s.replay(cc, req, resp, sending)
+			return
+		}
+		release = rel
+	}
+	called := make(chan error, 1)
+	sent := make(chan int32, 1)
+	req.endQueue()
+	releaseSlot = nil
 	//s.logger.Info("start handleRequest")
 	go func() {
-		err := req.svc.call(req.mtype, req.argv, req.replyv)
-		called <- struct{}{}
+		ctx, span := s.startHandler(req.ctx)
+		err := req.svc.call(ctx, req.mtype, req.argv, req.replyv)
+		req.mtype.release()
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+		// 超时或取消后方法仍在执行时幂等键一直被占用，重试会等待这次的结果
+		if release != nil {
+			saveResponse(req.replyv.Interface(), err, release)
+		}
+		called <- err
+		// 请求已被取消或超时，调用方不再等待响应
+		if req.ctx.Err() != nil {
+			sent <- 0
+			return
+		}
 		if err != nil {
 			req.h.Error = err.Error()
-			s.sendResponse(cc, req.h, invalidRequest, sending)
-			sent <- struct{}{}
+			sent <- s.sendResponse(cc, req.h, invalidRequest, sending)
 			return
 		}
-		s.sendResponse(cc, req.h, req.replyv.Interface(), sending)
-		sent <- struct{}{}
+		sent <- s.sendResponse(cc, req.h, req.replyv.Interface(), sending)
 		return
 	}()
-	if timeout == 0 {
-		<-called
-		<-sent
-		return
+	select {
+	case err := <-called:
+		if err != nil {
+			status = statusError
+		}
+		respBytes = <-sent
+	case <-req.ctx.Done():
+		status, respBytes = s.abandon(cc, req, sending)
+	}
+}
+
+// abandon 请求被取消或超时，客户端取消的请求不再响应，直接释放
+func (s *Server) abandon(cc codec.Codec, req *request, sending *sync.Mutex) (string, int32) {
+	if req.ctx.Err() != context.DeadlineExceeded {
+		return statusCanceled, 0
+	}
+	req.h.Error = "rpc server: request handle timeout"
+	return statusDeadlineExceeded, s.sendResponse(cc, req.h, invalidRequest, sending)
+}
+
+// authStatus 授权失败对应的请求状态
+func authStatus(err error) string {
+	if errors.Is(err, auth.ErrUnauthenticated) {
+		return statusUnauthenticated
+	}
+	return statusPermissionDenied
+}
+
+// newDirectRequest 不经过连接的请求，如HTTP网关和gRPC的请求，HTTP头作为请求元数据
+func newDirectRequest(serviceMethod string, svc *Service, mtype *MethodType, r *http.Request, t codec.Type) *request {
+	return &request{
+		h:      &codec.Header{ServiceMethod: serviceMethod},
+		md:     headerMetadata(r.Header),
+		peer:   httpPeer(r, t),
+		svc:    svc,
+		mtype:  mtype,
+		argv:   mtype.newArgs(),
+		replyv: mtype.newReply(),
+	}
+}
+
+// headerMetadata HTTP头转为请求元数据，同名的头只取第一个值
+func headerMetadata(header http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range header {
+		if len(v) > 0 {
+			md.Set(k, v[0])
+		}
+	}
+	return md
+}
+
+// callDirect 执行不经过连接的一元请求，返回请求状态，ctx结束时不再等待方法返回
+func (s *Server) callDirect(ctx context.Context, req *request) (status string, err error) {
+	ctx = metadata.NewIncomingContext(withPeer(ctx, req.peer), req.md)
+	ctx = s.startTrace(ctx, req, time.Now())
+	defer func() {
+		var msg string
+		if err != nil {
+			msg = err.Error()
+		}
+		req.endTrace(status, msg)
+	}()
+	if !req.mtype.acquire() {
+		return statusResourceExhausted, errTooManyRequests(req.h.ServiceMethod)
+	}
+	releaseSlot := req.mtype.release
+	defer func() {
+		if releaseSlot != nil {
+			releaseSlot()
+		}
+	}()
+	var release func(*idempotency.Response)
+	if key := s.idempotencyKey(req); key != "" {
+		resp, rel, err := s.idem.acquire(ctx, req.method(), key)
+		if err != nil {
+			return directAbandon(ctx)
+		}
+		if resp != nil {
+			if err = decodeResponse(resp, req.replyv.Interface()); err != nil {
+				return statusError, err
+			}
+			return statusOK, nil
+		}
+		release = rel
 	}
+	req.endQueue()
+	releaseSlot = nil
+	called := make(chan error, 1)
+	go func() {
+		ctx, span := s.startHandler(ctx)
+		err := req.svc.call(ctx, req.mtype, req.argv, req.replyv)
+		req.mtype.release()
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+		if release != nil {
+			saveResponse(req.replyv.Interface(), err, release)
+		}
+		called <- err
+	}()
 	select {
-	case <-called:
-		<-sent
-	case <-time.After(timeout):
-		req.h.Error = "rpc server: request handle timeout"
-		s.sendResponse(cc, req.h, invalidRequest, sending)
+	case err := <-called:
+		if err != nil {
+			return statusError, err
+		}
+		return statusOK, nil
+	case <-ctx.Done():
+		return directAbandon(ctx)
+	}
+}
+
+// directAbandon 不经过连接的请求被取消或超时
+func directAbandon(ctx context.Context) (string, error) {
+	if ctx.Err() == context.DeadlineExceeded {
+		return statusDeadlineExceeded, errors.New("rpc server: request handle timeout")
 	}
+	return statusCanceled, ctx.Err()
 }
 
+// Register 以结构体类型名注册服务，并把config.ServiceName写入注册中心
+// config.Endpoints为空时只在本地注册服务
 func (s *Server) Register(config RegisterConfig, rcvr interface{}) (err error) {
+	return s.RegisterName("", rcvr, config)
+}
+
+// RegisterName 以指定的服务名注册服务，name为空时使用结构体类型名
+// 同一个Server上的多个服务各自占用一个注册中心节点，共用一个租约，Close时一起撤销
+func (s *Server) RegisterName(name string, rcvr interface{}, config RegisterConfig) error {
+	var methods map[string]option.MethodOptions
 	// 可能不注册服务，单纯的注册到注册中心
 	if rcvr != nil {
-		err = s._register(rcvr)
+		svc, err := s._registerName(name, rcvr, config.Methods)
 		if err != nil {
 			return err
 		}
+		name = svc.name
+		methods = svc.methodOptions()
+	}
+	if len(config.Endpoints) == 0 {
+		return nil
 	}
 
-	config.Host = s.Host
-	s.register, err = NewServiceRegister(config)
-	if err != nil {
+	// 带版本的服务在节点的值中声明版本，客户端据此按版本选择实例，方法选项也一并公开
+	_, version := discovery.SplitVersion(name)
+	config.Host = discovery.Instance{Addr: s.Host, Version: version, Methods: methods}.String()
+	if err := s.registerInstance(config, name); err != nil {
+		// 注册中心注册失败时撤销本地注册
+		if rcvr != nil {
+			_ = s.Unregister(name)
+		}
 		return err
 	}
-	s.register.logger = s.logger
-	return
+	// 注册前服务可能已经不健康
+	s.syncRegistration(name, s.health.servingStatus(name))
+	return nil
 }
 
-func (s *Server) _register(rcvr interface{}) error {
-	service := newService(rcvr)
+// registerInstance 把服务写入注册中心，第一个服务创建租约，之后的服务挂到同一个租约上
+// 连接etcd可能耗时较长，不持有 s.mu
+func (s *Server) registerInstance(config RegisterConfig, name string) error {
+	s.mu.Lock()
+	register := s.register
+	s.mu.Unlock()
+	if register == nil {
+		created, err := newServiceRegister(config, name, s.logger)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		if s.register == nil {
+			s.register = created
+			s.mu.Unlock()
+			return nil
+		}
+		// 并发注册时已有其他服务创建了租约
+		register = s.register
+		s.mu.Unlock()
+		_ = created.Close()
+	}
+	return register.Put(config.ServiceName, config.Host, name)
+}
+
+func (s *Server) _register(rcvr interface{}) (*Service, error) {
+	return s._registerName("", rcvr, nil)
+}
+
+func (s *Server) _registerName(name string, rcvr interface{}, methods map[string]option.MethodOptions) (*Service, error) {
+	service, err := newNamedService(name, rcvr, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	if err = service.applyMethodOptions(methods, s.logger); err != nil {
+		return nil, err
+	}
 	if _, dup := s.ServiceMap.LoadOrStore(service.name, service); dup {
-		return errors.New("rpc: service already defined: " + service.name)
+		return nil, errors.New("rpc: service already defined: " + service.name)
+	}
+	if s.health != nil && service.name != HealthServiceName {
+		s.health.setServingStatus(service.name, healthpb.ServingStatus_SERVING)
 	}
 	s.logger.Info("register service success", zap.Any("service", service.name))
+	return service, nil
+}
+
+// Unregister 注销服务，正在处理的请求会在旧服务上执行完
+// 服务的健康状态随之移除，对应的注册中心节点也会被删除
+func (s *Server) Unregister(name string) error {
+	if _, ok := s.ServiceMap.LoadAndDelete(name); !ok {
+		return errors.New("rpc: service not defined: " + name)
+	}
+	if s.health != nil {
+		s.health.clearServingStatus(name)
+	}
+	s.logger.Info("unregister service success", zap.String("service", name))
+	return nil
+}
+
+// Replace 原子地替换同名服务的实现，之后的请求由新实现处理，正在处理的请求在旧实现上执行完
+func (s *Server) Replace(rcvr interface{}) error {
+	return s.ReplaceName("", rcvr)
+}
+
+// ReplaceName 替换以 RegisterName 注册的服务，新实现沿用旧实现同名方法的选项
+func (s *Server) ReplaceName(name string, rcvr interface{}) error {
+	service, err := newNamedService(name, rcvr, s.logger)
+	if err != nil {
+		return err
+	}
+	for {
+		old, ok := s.ServiceMap.Load(service.name)
+		if !ok {
+			return errors.New("rpc: service not defined: " + service.name)
+		}
+		service.inheritMethodOptions(old.(*Service))
+		if s.ServiceMap.CompareAndSwap(service.name, old, service) {
+			break
+		}
+	}
+	s.logger.Info("replace service success", zap.String("service", service.name))
 	return nil
 }
 
@@ -310,7 +900,10 @@ func (s *Server) _register(rcvr interface{}) error {
 
 func (s *Server) HandleHTTP() {
 	http.Handle(option.DefaultRPCPath, s)
+	http.Handle(option.DefaultWebSocketPath, s.WebSocketHandler())
+	http.Handle(option.DefaultJSONRPCPath, s.JSONRPCHandler())
 	http.Handle(option.DefaultDebugPath, debugHTTP{s})
+	http.Handle(option.DefaultMetricsPath, metricsHTTP{s})
 	//log.Println("rpc server debug path:", option.DefaultDebugPath)
 	s.logger.Info("rpc server debug path", zap.Any("option.DefaultDebugPath", option.DefaultDebugPath))
 }
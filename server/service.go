@@ -1,19 +1,37 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"github.com/yx-Anbf1a/anbrpc/discovery"
+	"github.com/yx-Anbf1a/anbrpc/option"
 	"go.uber.org/zap"
 	"go/ast"
 	"reflect"
+	"strings"
 	"sync/atomic"
 )
 
 type MethodType struct {
-	method    reflect.Method // 方法本身
-	ArgType   reflect.Type   // args
-	ReplyType reflect.Type   // rpy
-	numsCalls uint64         // 调用次数
+	method          reflect.Method // 方法本身
+	ArgType         reflect.Type   // args, 双向流方法为 *ServerStream
+	ReplyType       reflect.Type   // rpy, 流式方法为 *ServerStream
+	ServerStreaming bool           // 服务端流式方法
+	ClientStreaming bool           // 客户端流式方法，同时也是服务端流式方法，即双向流
+	withContext     bool           // 第一个参数是 context.Context
+	numsCalls       uint64         // 调用次数
+
+	opts   option.MethodOptions // 注册时设置的方法选项
+	logger *zap.Logger          // 按 opts.LogLevel 调整了级别的Logger
+	active *int64               // 正在处理的请求数，用于限制并发，替换实现时沿用
 }
 
+var (
+	errorType        = reflect.TypeOf((*error)(nil)).Elem()
+	contextType      = reflect.TypeOf((*context.Context)(nil)).Elem()
+	serverStreamType = reflect.TypeOf((*ServerStream)(nil))
+)
+
 // NumsCalls 获取调用次数
 func (m *MethodType) NumsCalls() uint64 {
 	return atomic.LoadUint64(&m.numsCalls)
@@ -58,29 +76,72 @@ func (s *Service) GetMethods() map[string]*MethodType {
 }
 
 // 传入结构体指针
-func newService(rcvr interface{}) *Service {
+func newService(rcvr interface{}) (*Service, error) {
+	return newNamedService("", rcvr, zap.NewNop())
+}
+
+// newNamedService name为空时以结构体类型名作为服务名
+func newNamedService(name string, rcvr interface{}, lg *zap.Logger) (*Service, error) {
 	s := new(Service)
-	s.typ = reflect.TypeOf(rcvr)                    // 指针指向的类型
-	s.rcvr = reflect.ValueOf(rcvr)                  // 指针指向的值
-	s.name = reflect.Indirect(s.rcvr).Type().Name() // 指针指向的对象的类型名
+	s.typ = reflect.TypeOf(rcvr)   // 指针指向的类型
+	s.rcvr = reflect.ValueOf(rcvr) // 指针指向的值
+	s.name = name
+	if s.name == "" {
+		s.name = reflect.Indirect(s.rcvr).Type().Name() // 指针指向的对象的类型名
+	}
 
-	// 结构体首字母必须大写
-	if !ast.IsExported(s.name) {
+	// 结构体首字母必须大写，带版本时版本不能为空
+	service, version := discovery.SplitVersion(s.name)
+	if !ast.IsExported(service) || (strings.Contains(s.name, discovery.VersionSeparator) && version == "") {
 		//log.Fatalf("rpc server: %s is not a valid service name", s.name)
-		zap.L().Fatal("rpc server: Service Name is not a valid service name", zap.Any("Service Name", s.name))
+		return nil, errors.New("rpc server: " + s.name + " is not a valid service name")
 	}
 	// 注册方法nAME
-	s.registerMethods()
-	return s
+	s.registerMethods(lg)
+	return s, nil
 }
 
-func (s *Service) registerMethods() {
+func (s *Service) registerMethods(lg *zap.Logger) {
 	s.method = make(map[string]*MethodType)
 	// 遍历方法
 	for i := 0; i < s.typ.NumMethod(); i++ {
 		m := s.typ.Method(i)
 		mTyp := m.Type
-		if mTyp.NumIn() != 2 || mTyp.NumOut() != 1 {
+		// 双向流方法: func (t *T) Method(stream *ServerStream) error
+		// 客户端流是只在最后发送一次响应的双向流
+		if mTyp.NumIn() == 2 && mTyp.In(1) == serverStreamType && mTyp.NumOut() == 1 && mTyp.Out(0) == errorType {
+			s.method[m.Name] = &MethodType{
+				method:          m,
+				ArgType:         serverStreamType,
+				ReplyType:       serverStreamType,
+				ServerStreaming: true,
+				ClientStreaming: true,
+			}
+			lg.Info("rpc server: register bidi stream method", zap.Any("service", s.name), zap.Any("method", m.Name))
+			continue
+		}
+		// 服务端流式方法: func (t *T) Method(args *Args, stream *ServerStream) error
+		if mTyp.NumIn() == 3 && mTyp.In(2) == serverStreamType && mTyp.NumOut() == 1 && mTyp.Out(0) == errorType {
+			if mTyp.In(1) == contextType || !isExportedOrBuiltinType(mTyp.In(1)) {
+				continue
+			}
+			s.method[m.Name] = &MethodType{
+				method:          m,
+				ArgType:         mTyp.In(1),
+				ReplyType:       serverStreamType,
+				ServerStreaming: true,
+			}
+			lg.Info("rpc server: register stream method", zap.Any("service", s.name), zap.Any("method", m.Name))
+			continue
+		}
+		// 普通方法: func (t *T) Method(args *Args) *Reply
+		// 或 func (t *T) Method(ctx context.Context, args *Args) *Reply，请求被取消或超时时ctx被取消
+		withContext := mTyp.NumIn() == 3 && mTyp.In(1) == contextType
+		if withContext {
+			if mTyp.NumOut() != 1 {
+				continue
+			}
+		} else if mTyp.NumIn() != 2 || mTyp.NumOut() != 1 {
 			// 方法必须是3个参数和1个返回值
 			continue
 		}
@@ -97,34 +158,62 @@ func (s *Service) registerMethods() {
 		//	// 返回值必须是error
 		//	continue
 		//}
-		argType, replyType := mTyp.In(1), mTyp.Out(0)
+		argType, replyType := mTyp.In(mTyp.NumIn()-1), mTyp.Out(0)
 
 		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
 			// 参数必须是导出类型或者内置类型
 			continue
 		}
 		s.method[m.Name] = &MethodType{
-			method:    m,
-			ArgType:   argType,
-			ReplyType: replyType,
+			method:      m,
+			ArgType:     argType,
+			ReplyType:   replyType,
+			withContext: withContext,
 		}
 		//log.Printf("rpc server: register %s.%s\n", s.name, m.Name)
-		zap.L().Info("rpc server: register method", zap.Any("service", s.name), zap.Any("method", m.Name))
+		lg.Info("rpc server: register method", zap.Any("service", s.name), zap.Any("method", m.Name))
+	}
+	for _, m := range s.method {
+		m.logger, m.active = lg, new(int64)
 	}
 }
 
-func (s *Service) call(m *MethodType, args reflect.Value, reply reflect.Value) error {
+func (s *Service) call(ctx context.Context, m *MethodType, args reflect.Value, reply reflect.Value) error {
 	atomic.AddUint64(&m.numsCalls, 1) // 原子性
 	f := m.method.Func
 	//returnValues := f.Call([]reflect.Value{s.rcvr, args, reply})
 	//if errInter := returnValues[0].Interface(); errInter != nil {
 	//	return errInter.(error)
 	//}
-	returnValues := f.Call([]reflect.Value{s.rcvr, args})
+	in := []reflect.Value{s.rcvr, args}
+	if m.withContext {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), args}
+	}
+	returnValues := f.Call(in)
 	reply.Elem().Set(returnValues[0].Elem())
 	return nil
 }
 
+// callStream 调用服务端流式方法
+func (s *Service) callStream(m *MethodType, args reflect.Value, stream *ServerStream) error {
+	atomic.AddUint64(&m.numsCalls, 1)
+	returnValues := m.method.Func.Call([]reflect.Value{s.rcvr, args, reflect.ValueOf(stream)})
+	if errInter := returnValues[0].Interface(); errInter != nil {
+		return errInter.(error)
+	}
+	return nil
+}
+
+// callBidiStream 调用客户端流或双向流方法
+func (s *Service) callBidiStream(m *MethodType, stream *ServerStream) error {
+	atomic.AddUint64(&m.numsCalls, 1)
+	returnValues := m.method.Func.Call([]reflect.Value{s.rcvr, reflect.ValueOf(stream)})
+	if errInter := returnValues[0].Interface(); errInter != nil {
+		return errInter.(error)
+	}
+	return nil
+}
+
 func isExportedOrBuiltinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
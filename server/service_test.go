@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"github.com/yx-Anbf1a/anbrpc/test_service"
 	"reflect"
@@ -27,22 +28,39 @@ func _assert(condition bool, msg string, v ...interface{}) {
 
 func TestNewService(t *testing.T) {
 	var foo test_service.FBoo
-	s := newService(&foo)
+	s, err := newService(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
 	mtype := s.method["Sum"]
 	if mtype == nil {
 		t.Fatal("can't find method Add")
 	}
 }
 
+func TestServer_RegisterInvalidName(t *testing.T) {
+	s := newTestServer(t, &test_service.FBoo{})
+	// 名字不合法时返回错误，不退出进程
+	for _, name := range []string{"fBoo", "FBoo@", "@v1"} {
+		err := s.RegisterName(name, &test_service.FBoo{}, RegisterConfig{})
+		_assert(err != nil, "expect error for %q", name)
+		err = s.ReplaceName(name, &test_service.FBoo{})
+		_assert(err != nil, "expect replace error for %q", name)
+	}
+}
+
 func TestMethodType_Calls(t *testing.T) {
 	var foo test_service.FBoo
-	s := newService(&foo)
+	s, err := newService(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
 	mType := s.method["Sum"]
 
 	argv := mType.newArgs()
 	replyv := mType.newReply()
 	argv.Elem().Set(reflect.ValueOf(test_service.FBooArgs{Num1: 1, Num2: 2}))
-	err := s.call(mType, argv, replyv)
+	err = s.call(context.Background(), mType, argv, replyv)
 	fmt.Println(replyv.Interface().(*test_service.FBooReply).Num)
 	_assert(err == nil && replyv.Interface().(*test_service.FBooReply).Num == 3 && mType.NumsCalls() == 1, "failed to call Foo.Sum")
 }
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/internal/flow"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrStreamClosed = errors.New("rpc server: stream closed")
+	// ErrWindowExceeded 客户端发送的消息超出了服务端授予的窗口
+	ErrWindowExceeded = errors.New("rpc server: stream window exceeded")
+	// errRawBodyUnsupported 编解码器无法缓存原始消息体，不支持接收客户端流
+	errRawBodyUnsupported = errors.New("rpc server: codec does not support client streaming")
+)
+
+// ServerStream 流式方法与客户端之间的流
+// 每个响应是一个 STREAM_DATA 帧，方法返回后发送 STREAM_END 或 STREAM_ERROR 帧
+// 客户端流和双向流还可以通过 Recv 按顺序读取客户端发来的消息
+// 两个方向各有一个以消息条数计的窗口，对端消费后通过 WINDOW_UPDATE 帧归还额度，
+// 读得慢的流只会阻塞自己的发送方，不影响同一连接上的其他流
+type ServerStream struct {
+	s             *Server // 用于记录日志
+	cc            codec.Codec
+	sending       *sync.Mutex
+	serviceMethod string
+	seq           uint64
+	ctx           context.Context // 客户端取消或连接断开时结束
+	window        *flow.Window    // 发送窗口
+	credit        *flow.Credit    // 接收额度
+
+	mu        sync.Mutex
+	closed    bool
+	sentBytes int32
+
+	recvMu     sync.Mutex
+	recvQueue  [][]byte
+	recvErr    error // 接收结束原因，io.EOF表示客户端正常结束发送
+	recvNotify chan struct{}
+}
+
+func newServerStream(ctx context.Context, s *Server, cc codec.Codec, sending *sync.Mutex, h *codec.Header, window int) *ServerStream {
+	return &ServerStream{
+		ctx:           ctx,
+		s:             s,
+		cc:            cc,
+		sending:       sending,
+		serviceMethod: h.ServiceMethod,
+		seq:           h.Seq,
+		window:        flow.NewWindow(window),
+		credit:        flow.NewCredit(window),
+		recvNotify:    make(chan struct{}, 1),
+	}
+}
+
+// Context 流的context，客户端取消或连接断开时被取消
+func (ss *ServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+// Send 发送一个响应，窗口用完时阻塞直到客户端归还额度，流结束后返回 ErrStreamClosed
+func (ss *ServerStream) Send(reply interface{}) error {
+	if err := ss.window.Acquire(ss.ctx.Done()); err != nil {
+		return ErrStreamClosed
+	}
+	return ss.write(&codec.Header{Type: codec.FrameType_STREAM_DATA}, reply)
+}
+
+// Recv 按顺序读取客户端发来的下一条消息到args，客户端结束发送时返回 io.EOF
+func (ss *ServerStream) Recv(args interface{}) error {
+	for {
+		ss.recvMu.Lock()
+		if len(ss.recvQueue) > 0 {
+			raw := ss.recvQueue[0]
+			ss.recvQueue[0] = nil
+			ss.recvQueue = ss.recvQueue[1:]
+			ss.recvMu.Unlock()
+			if n := ss.credit.Consume(); n > 0 {
+				_ = ss.write(&codec.Header{Type: codec.FrameType_WINDOW_UPDATE, Window: uint32(n)}, invalidRequest)
+			}
+			rc, ok := ss.cc.(codec.RawBodyCodec)
+			if !ok {
+				return errRawBodyUnsupported
+			}
+			return rc.Unmarshal(raw, args)
+		}
+		if ss.recvErr != nil {
+			err := ss.recvErr
+			ss.recvMu.Unlock()
+			return err
+		}
+		ss.recvMu.Unlock()
+		select {
+		case <-ss.recvNotify:
+		case <-ss.ctx.Done():
+			ss.closeRecv(ss.ctx.Err())
+		}
+	}
+}
+
+func (ss *ServerStream) signalRecv() {
+	select {
+	case ss.recvNotify <- struct{}{}:
+	default:
+	}
+}
+
+// pushRecv 连接的读协程收到一条流数据
+func (ss *ServerStream) pushRecv(raw []byte) {
+	ss.recvMu.Lock()
+	defer ss.recvMu.Unlock()
+	if ss.recvErr != nil {
+		return
+	}
+	if !ss.credit.Receive() {
+		// 客户端不遵守窗口，丢弃已缓存的消息并结束接收，方法随后以错误结束流
+		ss.recvQueue = nil
+		ss.recvErr = ErrWindowExceeded
+		ss.signalRecv()
+		return
+	}
+	ss.recvQueue = append(ss.recvQueue, raw)
+	ss.signalRecv()
+}
+
+// closeRecv 结束接收方向，只记录第一次的原因，已缓存的消息仍可读取
+func (ss *ServerStream) closeRecv(err error) {
+	ss.recvMu.Lock()
+	defer ss.recvMu.Unlock()
+	if ss.recvErr == nil {
+		ss.recvErr = err
+	}
+	ss.signalRecv()
+}
+
+func (ss *ServerStream) write(h *codec.Header, body interface{}) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.closed {
+		return ErrStreamClosed
+	}
+	if h.Type == codec.FrameType_STREAM_END || h.Type == codec.FrameType_STREAM_ERROR {
+		ss.closed = true
+	}
+	h.ServiceMethod = ss.serviceMethod
+	h.Seq = ss.seq
+	ss.sending.Lock()
+	err := ss.cc.Write(h, body)
+	ss.sending.Unlock()
+	if err != nil {
+		ss.closed = true
+		ss.s.logger.Error("rpc server: write stream frame error:", zap.Error(err))
+		return err
+	}
+	if h.Type == codec.FrameType_STREAM_DATA {
+		ss.sentBytes += h.BodySize
+	}
+	return nil
+}
+
+// close 方法返回后结束流
+func (ss *ServerStream) close(err error) int32 {
+	if err != nil {
+		_ = ss.write(&codec.Header{Type: codec.FrameType_STREAM_ERROR, Error: err.Error()}, invalidRequest)
+	} else {
+		_ = ss.write(&codec.Header{Type: codec.FrameType_STREAM_END}, invalidRequest)
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.sentBytes
+}
+
+// handleStream 处理流式请求，流可能长时间存在，不受HandleTimeOut限制
+func (s *Server) handleStream(req *request) (status string, respBytes int32) {
+	stream := req.stream
+	defer req.conn.removeStream(stream.seq)
+	var err error
+	if req.mtype.ClientStreaming {
+		err = req.svc.callBidiStream(req.mtype, stream)
+	} else {
+		err = req.svc.callStream(req.mtype, req.argv, stream)
+	}
+	respBytes = stream.close(err)
+	if err != nil {
+		return statusError, respBytes
+	}
+	return statusOK, respBytes
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/codec"
+	"github.com/yx-Anbf1a/anbrpc/option"
+
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+type Counter struct{}
+
+// Count 依次发送 Num1..Num2
+func (c *Counter) Count(args *test_service.FBooArgs, stream *ServerStream) error {
+	if args.Num1 > args.Num2 {
+		return errors.New("bad range")
+	}
+	for i := args.Num1; i <= args.Num2; i++ {
+		if err := stream.Send(&test_service.FBooReply{Num: i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Counter) Sum(args *test_service.FBooArgs) *test_service.FBooReply {
+	return &test_service.FBooReply{Num: args.Num1 + args.Num2}
+}
+
+// Echo 双向流，每收到一条消息回复一次
+func (c *Counter) Echo(stream *ServerStream) error {
+	for {
+		var args test_service.FBooArgs
+		if err := stream.Recv(&args); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := stream.Send(&test_service.FBooReply{Num: args.Num1 + args.Num2}); err != nil {
+			return err
+		}
+	}
+}
+
+// Total 客户端流，结束后回复所有消息的和
+func (c *Counter) Total(stream *ServerStream) error {
+	var total int32
+	for {
+		var args test_service.FBooArgs
+		if err := stream.Recv(&args); err == io.EOF {
+			return stream.Send(&test_service.FBooReply{Num: total})
+		} else if err != nil {
+			return err
+		}
+		total += args.Num1 + args.Num2
+	}
+}
+
+// Flood 不停发送，记录已经发出的条数
+type Flood struct {
+	sent int32
+}
+
+func (f *Flood) Flood(args *test_service.FBooArgs, stream *ServerStream) error {
+	for i := int32(0); i < args.Num1; i++ {
+		if err := stream.Send(&test_service.FBooReply{Num: i}); err != nil {
+			return err
+		}
+		atomic.AddInt32(&f.sent, 1)
+	}
+	return nil
+}
+
+func TestServerStreaming(t *testing.T) {
+	s := newTestServer(t, &Counter{})
+	_assert(s.mustMethod("Counter.Count").ServerStreaming, "Count should be a stream method")
+	c := dialTestServer(t, s)
+
+	stream, err := c.Stream(context.Background(), "Counter.Count", &test_service.FBooArgs{Num1: 1, Num2: 5}, (*test_service.FBooReply)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 流和普通调用共用一个连接
+	var reply test_service.FBooReply
+	if err = c.Call(context.Background(), "Counter.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	var got []int32
+	for r, err := range stream.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r.(*test_service.FBooReply).Num)
+	}
+	_assert(len(got) == 5 && got[0] == 1 && got[4] == 5, "unexpected stream replies %v", got)
+	_, err = stream.Recv()
+	_assert(err == io.EOF, "expect EOF after end, got %v", err)
+
+	stream, err = c.Stream(context.Background(), "Counter.Count", &test_service.FBooArgs{Num1: 5, Num2: 1}, (*test_service.FBooReply)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	_assert(err != nil && err.Error() == "bad range", "expect stream error, got %v", err)
+}
+
+func TestBidiStreaming(t *testing.T) {
+	s := newTestServer(t, &Counter{})
+	m := s.mustMethod("Counter.Echo")
+	_assert(m.ServerStreaming && m.ClientStreaming, "Echo should be a bidi stream method")
+	c := dialTestServer(t, s)
+
+	stream, err := c.NewStream(context.Background(), "Counter.Echo", (*test_service.FBooReply)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int32(0); i < 3; i++ {
+		if err = stream.Send(&test_service.FBooArgs{Num1: i, Num2: 10}); err != nil {
+			t.Fatal(err)
+		}
+		r, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_assert(r.(*test_service.FBooReply).Num == i+10, "unexpected echo %v", r)
+	}
+	if err = stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	_assert(err == io.EOF, "expect EOF after CloseSend, got %v", err)
+
+	stream, err = c.NewStream(context.Background(), "Counter.Total", (*test_service.FBooReply)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 超过窗口大小的消息需要服务端归还额度
+	for i := 0; i < 200; i++ {
+		if err = stream.Send(&test_service.FBooArgs{Num1: 1, Num2: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_assert(r.(*test_service.FBooReply).Num == 400, "unexpected total %v", r)
+}
+
+func TestStreamFlowControl(t *testing.T) {
+	f := &Flood{}
+	s := newTestServer(t, f, &Counter{})
+	c := dialTestServer(t, s, &option.Option{StreamWindow: 4})
+
+	slow, err := c.Stream(context.Background(), "Flood.Flood", &test_service.FBooArgs{Num1: 100}, (*test_service.FBooReply)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	// 客户端没有读取，服务端发完窗口后阻塞
+	_assert(atomic.LoadInt32(&f.sent) == 4, "expect sender blocked at window, sent %d", atomic.LoadInt32(&f.sent))
+
+	// 阻塞的流不影响同一连接上的其他调用
+	var reply test_service.FBooReply
+	if err = c.Call(context.Background(), "Counter.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 3, "unexpected reply %v", reply.Num)
+
+	n := 0
+	for _, err := range slow.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	_assert(n == 100, "expect 100 replies, got %d", n)
+}
+
+func TestStreamWindowExceeded(t *testing.T) {
+	ss := newServerStream(context.Background(), nil, nil, &sync.Mutex{}, &codec.Header{}, 2)
+	for i := 0; i < 3; i++ {
+		ss.pushRecv([]byte{})
+	}
+	var args test_service.FBooArgs
+	err := ss.Recv(&args)
+	_assert(errors.Is(err, ErrWindowExceeded), "expect ErrWindowExceeded, got %v", err)
+}
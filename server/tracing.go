@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/tracing"
+)
+
+// WithTracer 为每个请求创建服务端span，以及排队和执行处理方法两个子span
+// 不设置时不记录，但调用方的traceparent仍然传给处理方法，处理方法中发起的调用继续同一个trace
+func (s *Server) WithTracer(tracer tracing.Tracer) {
+	s.tracer = tracer
+}
+
+// startTrace 以请求元数据中的traceparent为父span开始服务端span，排队时间从arrived开始
+func (s *Server) startTrace(ctx context.Context, req *request, arrived time.Time) context.Context {
+	if sc, ok := tracing.Extract(req.md); ok {
+		ctx = tracing.ContextWithRemoteSpanContext(ctx, sc)
+	}
+	attrs := []tracing.Attribute{tracing.Attr("rpc.method", req.h.ServiceMethod)}
+	if req.peer != nil {
+		attrs = append(attrs, tracing.Attr("net.peer", req.peer.Addr), tracing.Attr("rpc.conn_id", req.peer.ConnID))
+	}
+	ctx, req.span = tracing.Start(ctx, s.tracer, req.h.ServiceMethod, tracing.WithSpanKind(tracing.SpanKindServer),
+		tracing.WithTimestamp(arrived), tracing.WithAttributes(attrs...))
+	_, req.queueSpan = tracing.Start(ctx, s.tracer, "queue", tracing.WithTimestamp(arrived))
+	return ctx
+}
+
+// endQueue 请求开始执行，排队结束
+func (req *request) endQueue() {
+	if req.queueSpan != nil {
+		req.queueSpan.End()
+		req.queueSpan = nil
+	}
+}
+
+// startHandler 执行处理方法的span，处理方法中发起的调用以它为父span
+func (s *Server) startHandler(ctx context.Context) (context.Context, tracing.Span) {
+	return tracing.Start(ctx, s.tracer, "handler")
+}
+
+// endTrace 请求处理完成，非OK的状态记为错误，msg为返回给调用方的错误
+func (req *request) endTrace(status, msg string) {
+	req.endQueue()
+	if req.span == nil {
+		return
+	}
+	req.span.SetAttributes(tracing.Attr("rpc.status", status))
+	if status != statusOK {
+		if msg == "" {
+			msg = status
+		}
+		req.span.RecordError(errors.New(msg))
+	}
+	req.span.End()
+}
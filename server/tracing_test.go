@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/client"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+	"github.com/yx-Anbf1a/anbrpc/tracing"
+)
+
+// recordTracer 记录结束的span，span id 依次递增
+type recordTracer struct {
+	mu    sync.Mutex
+	next  uint64
+	spans []*recordSpan
+}
+
+type recordSpan struct {
+	tr     *recordTracer
+	name   string
+	kind   tracing.SpanKind
+	sc     tracing.SpanContext
+	parent tracing.SpanContext
+}
+
+func (t *recordTracer) Start(ctx context.Context, name string, opts ...tracing.SpanOption) (context.Context, tracing.Span) {
+	cfg := tracing.NewSpanConfig(opts...)
+	parent := tracing.SpanContextFromContext(ctx)
+	t.mu.Lock()
+	t.next++
+	sc := tracing.SpanContext{TraceID: parent.TraceID, Sampled: true}
+	if !parent.IsValid() {
+		binary.BigEndian.PutUint64(sc.TraceID[8:], t.next)
+	}
+	binary.BigEndian.PutUint64(sc.SpanID[:], t.next)
+	t.mu.Unlock()
+	span := &recordSpan{tr: t, name: name, kind: cfg.Kind, sc: sc, parent: parent}
+	return tracing.ContextWithSpan(ctx, span), span
+}
+
+func (t *recordTracer) find(name string, kind tracing.SpanKind) []*recordSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var spans []*recordSpan
+	for _, s := range t.spans {
+		if s.name == name && s.kind == kind {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+func (s *recordSpan) SpanContext() tracing.SpanContext   { return s.sc }
+func (s *recordSpan) SetAttributes(...tracing.Attribute) {}
+func (s *recordSpan) RecordError(error)                  {}
+func (s *recordSpan) End() {
+	s.tr.mu.Lock()
+	defer s.tr.mu.Unlock()
+	s.tr.spans = append(s.tr.spans, s)
+}
+
+// Forwarder 在处理方法中调用 FBoo.Sum，并记录收到请求时的trace
+type Forwarder struct {
+	c     *client.Client
+	mu    sync.Mutex
+	trace tracing.SpanContext
+}
+
+func (r *Forwarder) Sum(ctx context.Context, args *test_service.FBooArgs) *test_service.FBooReply {
+	r.mu.Lock()
+	r.trace = tracing.SpanContextFromContext(ctx)
+	r.mu.Unlock()
+	var reply test_service.FBooReply
+	_ = r.c.Call(ctx, "FBoo.Sum", args, &reply)
+	return &reply
+}
+
+func TestServer_Tracing(t *testing.T) {
+	fwd := &Forwarder{}
+	s := newTestServer(t, fwd, &test_service.FBoo{})
+	tr := &recordTracer{}
+	s.WithTracer(tr)
+	fwd.c = dialTestServer(t, s)
+	fwd.c.WithTracer(tr)
+	c := dialTestServer(t, s)
+	c.WithTracer(tr)
+
+	var reply test_service.FBooReply
+	if err := c.Call(context.Background(), "Forwarder.Sum", &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	_assert(reply.Num == 3, "expect 3, got %d", reply.Num)
+	// 服务端span在发送响应之后结束
+	waitIdle(t, s, "Forwarder.Sum")
+	waitIdle(t, s, "FBoo.Sum")
+
+	spans := map[string]*recordSpan{}
+	for _, want := range []struct {
+		key, name string
+		kind      tracing.SpanKind
+		n         int
+	}{
+		{"client", "Forwarder.Sum", tracing.SpanKindClient, 1},
+		{"server", "Forwarder.Sum", tracing.SpanKindServer, 1},
+		{"nestedClient", "FBoo.Sum", tracing.SpanKindClient, 1},
+		{"nestedServer", "FBoo.Sum", tracing.SpanKindServer, 1},
+		{"queue", "queue", tracing.SpanKindInternal, 2},
+		{"handler", "handler", tracing.SpanKindInternal, 2},
+	} {
+		found := tr.find(want.name, want.kind)
+		_assert(len(found) == want.n, "expect %d %s spans, got %d", want.n, want.key, len(found))
+		spans[want.key] = found[0]
+	}
+	traceID := spans["client"].sc.TraceID
+	for key, span := range spans {
+		_assert(span.sc.TraceID == traceID, "%s span not in the same trace", key)
+	}
+	_assert(!spans["client"].parent.IsValid(), "client span should be a root")
+	_assert(spans["server"].parent.SpanID == spans["client"].sc.SpanID && spans["server"].parent.Remote, "server span parent should be the remote client span")
+	for _, key := range []string{"queue", "handler"} {
+		for _, span := range tr.find(key, tracing.SpanKindInternal) {
+			_assert(span.parent == spans["server"].sc || span.parent == spans["nestedServer"].sc, "%s span should be a child of a server span", key)
+		}
+	}
+	// 处理方法中的调用以处理方法的span为父span
+	var handler *recordSpan
+	for _, span := range tr.find("handler", tracing.SpanKindInternal) {
+		if span.parent == spans["server"].sc {
+			handler = span
+		}
+	}
+	_assert(handler != nil && spans["nestedClient"].parent == handler.sc, "nested call should continue from the handler span")
+	_assert(spans["nestedServer"].parent.SpanID == spans["nestedClient"].sc.SpanID, "nested server span parent should be the nested client span")
+}
+
+func TestServer_TracingPassthrough(t *testing.T) {
+	// 两端都不设置Tracer时，调用方的trace原样传给处理方法和下游
+	fwd := &Forwarder{}
+	s := newTestServer(t, fwd, &test_service.FBoo{})
+	fwd.c = dialTestServer(t, s)
+	c := dialTestServer(t, s)
+
+	upstream, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := tracing.ContextWithRemoteSpanContext(context.Background(), upstream)
+	var reply test_service.FBooReply
+	if err := c.Call(ctx, "Forwarder.Sum", &test_service.FBooArgs{Num1: 1}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	fwd.mu.Lock()
+	defer fwd.mu.Unlock()
+	_assert(fwd.trace.TraceID == upstream.TraceID && fwd.trace.SpanID == upstream.SpanID, "expect upstream trace in handler, got %+v", fwd.trace)
+}
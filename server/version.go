@@ -0,0 +1,26 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/yx-Anbf1a/anbrpc/discovery"
+)
+
+// latestVersion 服务名不带版本且没有以该名字注册服务时，返回版本最高的 name@version 服务
+// 同一个服务的多个版本可以同时注册，迁移期间旧客户端的调用落到最新版本上
+func (s *Server) latestVersion(name string) *Service {
+	var latest *Service
+	var latestVersion string
+	prefix := name + discovery.VersionSeparator
+	s.ServiceMap.Range(func(key, value interface{}) bool {
+		if !strings.HasPrefix(key.(string), prefix) {
+			return true
+		}
+		_, version := discovery.SplitVersion(key.(string))
+		if latest == nil || discovery.CompareVersions(version, latestVersion) > 0 {
+			latest, latestVersion = value.(*Service), version
+		}
+		return true
+	})
+	return latest
+}
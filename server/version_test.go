@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yx-Anbf1a/anbrpc/auth"
+	"github.com/yx-Anbf1a/anbrpc/client"
+	"github.com/yx-Anbf1a/anbrpc/idempotency"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+type CalcV1 struct{}
+
+func (c *CalcV1) Sum(args *test_service.FBooArgs) *test_service.FBooReply {
+	return &test_service.FBooReply{Num: args.Num1 + args.Num2}
+}
+
+// CalcV2 新版本的结果乘以10，便于区分由哪个版本处理
+type CalcV2 struct{}
+
+func (c *CalcV2) Sum(args *test_service.FBooArgs) *test_service.FBooReply {
+	return &test_service.FBooReply{Num: (args.Num1 + args.Num2) * 10}
+}
+
+func TestServer_Versions(t *testing.T) {
+	s := newTestServer(t)
+	for name, rcvr := range map[string]interface{}{"Calc@v1": &CalcV1{}, "Calc@v2": &CalcV2{}} {
+		if err := s.RegisterName(name, rcvr, RegisterConfig{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := dialTestServer(t, s)
+	sum := func(serviceMethod string) (int32, error) {
+		var reply test_service.FBooReply
+		err := c.Call(context.Background(), serviceMethod, &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply)
+		return reply.Num, err
+	}
+
+	n, err := sum("Calc@v1.Sum")
+	_assert(err == nil && n == 3, "expect v1 result 3, got %d %v", n, err)
+	n, err = sum("Calc@v2.Sum")
+	_assert(err == nil && n == 30, "expect v2 result 30, got %d %v", n, err)
+	// 不带版本时由最新版本处理
+	n, err = sum("Calc.Sum")
+	_assert(err == nil && n == 30, "expect latest version result 30, got %d %v", n, err)
+	_, err = sum("Calc@v3.Sum")
+	_assert(err != nil, "expect unknown version error")
+
+	// 注册同名的无版本服务后，不带版本的调用由它处理
+	if err = s.RegisterName("Calc", &CalcV1{}, RegisterConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	n, err = sum("Calc.Sum")
+	_assert(err == nil && n == 3, "expect unversioned service result 3, got %d %v", n, err)
+}
+
+func TestServer_VersionCanonicalMethod(t *testing.T) {
+	s := newTestServer(t)
+	for name, rcvr := range map[string]interface{}{"Calc@v1": &CalcV1{}, "Calc@v2": &CalcV2{}} {
+		if err := s.RegisterName(name, rcvr, RegisterConfig{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.WithAuth(auth.NewTokenAuthenticator(map[string]*auth.Identity{
+		"alice-token": {Principal: "alice"},
+		"bob-token":   {Principal: "bob"},
+	}), auth.NewAuthorizer(&auth.Policy{
+		Rules: []auth.Rule{{Method: "Calc.*", Deny: auth.Subjects{Principals: []string{"bob"}}}},
+	}))
+	s.WithIdempotency(idempotency.NewMemoryStore(100, time.Minute))
+
+	// 授权策略按不带版本的服务名匹配，指定版本也不能绕过
+	bob := dialTestServer(t, s)
+	bob.WithCredentials(client.BearerToken("bob-token"))
+	for _, serviceMethod := range []string{"Calc.Sum", "Calc@v1.Sum", "Calc@v2.Sum"} {
+		var reply test_service.FBooReply
+		err := bob.Call(context.Background(), serviceMethod, &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply)
+		_assert(err != nil && strings.Contains(err.Error(), auth.ErrPermissionDenied.Error()), "expect %s denied, got %v", serviceMethod, err)
+	}
+
+	// 不带版本的调用按处理它的版本计入指标，幂等键也与指定版本的调用共用
+	alice := dialTestServer(t, s)
+	alice.WithCredentials(client.BearerToken("alice-token"))
+	ctx := idempotency.WithKey(context.Background(), "k1")
+	for _, serviceMethod := range []string{"Calc.Sum", "Calc@v2.Sum"} {
+		var reply test_service.FBooReply
+		if err := alice.Call(ctx, serviceMethod, &test_service.FBooArgs{Num1: 1, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		_assert(reply.Num == 30, "expect 30, got %d", reply.Num)
+	}
+	_assert(s.mustMethod("Calc@v2.Sum").NumsCalls() == 1, "retry through the versioned name must be replayed")
+	// 包括bob被拒绝的两次调用
+	waitIdle(t, s, "Calc@v2.Sum")
+	st := s.metrics.stats("Calc@v2.Sum")
+	_assert(st.calls == 4, "expect 4 calls recorded under Calc@v2.Sum, got %d", st.calls)
+	_assert(s.metrics.stats("Calc.Sum").calls == 0, "unversioned calls must not be recorded under Calc.Sum")
+}
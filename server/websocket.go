@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+// wsConn WebSocket连接，RemoteAddr 返回的是Origin，换成HTTP请求的对端地址，供按IP限制连接数使用
+type wsConn struct {
+	*websocket.Conn
+	remote net.Addr
+}
+
+func (c wsConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type wsAddr string
+
+func (a wsAddr) Network() string { return "websocket" }
+func (a wsAddr) String() string  { return string(a) }
+
+// WebSocketHandler 通过WebSocket二进制消息收发anbrpc帧，适用于只允许WebSocket通过的代理
+// 连接建立后与TCP连接完全相同，不检查Origin
+func (s *Server) WebSocketHandler() http.Handler {
+	return websocket.Server{Handler: func(ws *websocket.Conn) {
+		ws.PayloadType = websocket.BinaryFrame
+		s.serveConn(wsConn{Conn: ws, remote: wsAddr(ws.Request().RemoteAddr)})
+	}}
+}
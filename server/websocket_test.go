@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/client"
+	"github.com/yx-Anbf1a/anbrpc/test_service"
+)
+
+func dialWebSocket(t *testing.T, addr string) (*client.Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.DDial("ws", conn)
+}
+
+func TestWebSocket(t *testing.T) {
+	var foo test_service.FBoo
+	s := newTestServer(t, &foo)
+	hs := httptest.NewServer(s.WebSocketHandler())
+	defer hs.Close()
+	addr := strings.TrimPrefix(hs.URL, "http://")
+
+	c, err := dialWebSocket(t, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := int32(0); i < 3; i++ {
+		var reply test_service.FBooReply
+		if err := c.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{Num1: i, Num2: 2}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		_assert(reply.Num == i+2, "expect %d, got %d", i+2, reply.Num)
+	}
+
+	// 按IP限制连接数使用的是HTTP请求的对端地址
+	s.limiter.maxPerIP = 1
+	c2, err := dialWebSocket(t, addr)
+	if err == nil {
+		defer c2.Close()
+		var reply test_service.FBooReply
+		err = c2.Call(context.Background(), "FBoo.Sum", &test_service.FBooArgs{}, &reply)
+	}
+	_assert(err != nil, "expect connection over per ip limit rejected")
+}
@@ -0,0 +1,123 @@
+// Package oteltracing 把 OpenTelemetry 的 Tracer 适配为 tracing.Tracer
+package oteltracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yx-Anbf1a/anbrpc/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer 用OpenTelemetry创建span，返回的ctx同时包含OpenTelemetry的span，处理方法中直接使用OpenTelemetry创建的span也在同一个trace中
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ tracing.Tracer = (*Tracer)(nil)
+
+// New 如 New(otel.Tracer("anbrpc"))
+func New(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, opts ...tracing.SpanOption) (context.Context, tracing.Span) {
+	cfg := tracing.NewSpanConfig(opts...)
+	// ctx中已有OpenTelemetry的span时它是最近的父span，否则使用ctx中的本地span或调用方的span
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if parent := tracing.SpanContextFromContext(ctx); parent.IsValid() {
+			ctx = trace.ContextWithSpanContext(ctx, toOTel(parent))
+		}
+	}
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(spanKind(cfg.Kind)),
+		trace.WithTimestamp(cfg.Timestamp),
+		trace.WithAttributes(attributes(cfg.Attributes)...),
+	)
+	s := &otelSpan{span: span}
+	return tracing.ContextWithSpan(ctx, s), s
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) SpanContext() tracing.SpanContext {
+	return fromOTel(s.span.SpanContext())
+}
+
+func (s *otelSpan) SetAttributes(attrs ...tracing.Attribute) {
+	s.span.SetAttributes(attributes(attrs)...)
+}
+
+func (s *otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *otelSpan) End() {
+	s.span.End()
+}
+
+func toOTel(sc tracing.SpanContext) trace.SpanContext {
+	cfg := trace.SpanContextConfig{
+		TraceID: trace.TraceID(sc.TraceID),
+		SpanID:  trace.SpanID(sc.SpanID),
+		Remote:  sc.Remote,
+	}
+	if sc.Sampled {
+		cfg.TraceFlags = trace.FlagsSampled
+	}
+	if sc.TraceState != "" {
+		cfg.TraceState, _ = trace.ParseTraceState(sc.TraceState)
+	}
+	return trace.NewSpanContext(cfg)
+}
+
+func fromOTel(sc trace.SpanContext) tracing.SpanContext {
+	return tracing.SpanContext{
+		TraceID:    tracing.TraceID(sc.TraceID()),
+		SpanID:     tracing.SpanID(sc.SpanID()),
+		Sampled:    sc.IsSampled(),
+		TraceState: sc.TraceState().String(),
+		Remote:     sc.IsRemote(),
+	}
+}
+
+func spanKind(kind tracing.SpanKind) trace.SpanKind {
+	switch kind {
+	case tracing.SpanKindClient:
+		return trace.SpanKindClient
+	case tracing.SpanKindServer:
+		return trace.SpanKindServer
+	default:
+		return trace.SpanKindInternal
+	}
+}
+
+func attributes(attrs []tracing.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(a.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(a.Key, v))
+		case int32:
+			kvs = append(kvs, attribute.Int64(a.Key, int64(v)))
+		case int64:
+			kvs = append(kvs, attribute.Int64(a.Key, v))
+		case uint64:
+			kvs = append(kvs, attribute.Int64(a.Key, int64(v)))
+		case bool:
+			kvs = append(kvs, attribute.Bool(a.Key, v))
+		case float64:
+			kvs = append(kvs, attribute.Float64(a.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,29 @@
+package oteltracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer_Parent(t *testing.T) {
+	parent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	parent.TraceState = "vendor=1"
+	ctx := tracing.ContextWithRemoteSpanContext(context.Background(), parent)
+
+	// 不记录的Tracer原样返回父span，可以用来检查转换
+	tr := New(trace.NewNoopTracerProvider().Tracer("test"))
+	ctx, span := tr.Start(ctx, "Svc.Method", tracing.WithSpanKind(tracing.SpanKindServer))
+	defer span.End()
+	if got := span.SpanContext(); got.TraceID != parent.TraceID || got.SpanID != parent.SpanID || !got.Sampled || got.TraceState != "vendor=1" {
+		t.Fatalf("unexpected span context %+v", got)
+	}
+	if tracing.SpanFromContext(ctx) != span {
+		t.Fatal("expect span in ctx")
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.TraceID() != trace.TraceID(parent.TraceID) {
+		t.Fatalf("expect OpenTelemetry span in ctx, got %v", sc.TraceID())
+	}
+}
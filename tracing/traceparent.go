@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/yx-Anbf1a/anbrpc/metadata"
+)
+
+// W3C Trace Context 使用的元数据key
+const (
+	TraceparentKey = "traceparent"
+	TracestateKey  = "tracestate"
+)
+
+// ErrInvalidTraceparent traceparent 格式错误，或者trace id、span id全为零
+var ErrInvalidTraceparent = errors.New("tracing: invalid traceparent")
+
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// SpanContext 跨进程传递的span标识
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string // tracestate 原样传递
+	Remote     bool   // 从对端的请求中解析得到
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent 格式化为 00-{trace id}-{span id}-{flags}
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent 解析 traceparent，高于00的版本按00的格式读取前四段
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, ErrInvalidTraceparent
+	}
+	var version, flags [1]byte
+	if !decodeHex(version[:], parts[0]) || !decodeHex(sc.TraceID[:], parts[1]) ||
+		!decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) || !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// decodeHex 只接受小写十六进制，长度必须与dst一致
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Inject 把ctx中的span写入元数据，返回新的元数据，不修改md；ctx中没有span时原样返回
+func Inject(ctx context.Context, md metadata.MD) metadata.MD {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return md
+	}
+	out := metadata.Join(md, metadata.Pairs(TraceparentKey, sc.Traceparent()))
+	if sc.TraceState != "" {
+		out.Set(TracestateKey, sc.TraceState)
+	}
+	return out
+}
+
+// Extract 从请求元数据中解析调用方的span
+func Extract(md metadata.MD) (SpanContext, bool) {
+	tp := md.Get(TraceparentKey)
+	if tp == "" {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = md.Get(TracestateKey)
+	sc.Remote = true
+	return sc, true
+}
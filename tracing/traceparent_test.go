@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yx-Anbf1a/anbrpc/metadata"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+	if got := sc.Traceparent(); got != tp {
+		t.Fatalf("round trip: got %s", got)
+	}
+	// 更高的版本可以带更多字段
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Fatalf("future version: %v", err)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(bad); err == nil {
+			t.Errorf("expect error for %q", bad)
+		}
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	md := metadata.Pairs("k", "v")
+	if out := Inject(context.Background(), md); out.Get(TraceparentKey) != "" {
+		t.Fatal("no trace in ctx, expect no traceparent")
+	}
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	sc.TraceState = "vendor=1"
+	ctx := ContextWithRemoteSpanContext(context.Background(), sc)
+	out := Inject(ctx, md)
+	if md.Get(TraceparentKey) != "" {
+		t.Fatal("Inject must not modify md")
+	}
+	got, ok := Extract(out)
+	if !ok || got != SpanContextFromContext(ctx) || out.Get("k") != "v" {
+		t.Fatalf("unexpected extract %+v %v, md %v", got, ok, out)
+	}
+	if _, ok := Extract(metadata.Pairs(TraceparentKey, "bad")); ok {
+		t.Fatal("expect invalid traceparent ignored")
+	}
+}
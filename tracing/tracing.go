@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"time"
+)
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindClient
+	SpanKindServer
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindClient:
+		return "client"
+	case SpanKindServer:
+		return "server"
+	default:
+		return "internal"
+	}
+}
+
+// Attribute span的属性，Value 一般是 string、int64、bool 或 float64
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanConfig 开始span时的参数
+type SpanConfig struct {
+	Kind       SpanKind
+	Timestamp  time.Time // 开始时间，为零时是当前时间
+	Attributes []Attribute
+}
+
+type SpanOption func(*SpanConfig)
+
+func WithSpanKind(kind SpanKind) SpanOption {
+	return func(c *SpanConfig) { c.Kind = kind }
+}
+
+// WithTimestamp 指定开始时间，用于记录已经发生的排队等时间段
+func WithTimestamp(t time.Time) SpanOption {
+	return func(c *SpanConfig) { c.Timestamp = t }
+}
+
+func WithAttributes(attrs ...Attribute) SpanOption {
+	return func(c *SpanConfig) { c.Attributes = append(c.Attributes, attrs...) }
+}
+
+// NewSpanConfig 供 Tracer 的实现使用
+func NewSpanConfig(opts ...SpanOption) SpanConfig {
+	var c SpanConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.Timestamp.IsZero() {
+		c.Timestamp = time.Now()
+	}
+	return c
+}
+
+// Tracer 创建span，可以通过 oteltracing 适配 OpenTelemetry
+// Start 以 SpanContextFromContext(ctx) 为父span，没有时开始新的trace，返回的ctx需要经过 ContextWithSpan 包含新span
+type Tracer interface {
+	Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, Span)
+}
+
+// Span 一段被追踪的操作，End 之后不再修改
+type Span interface {
+	SpanContext() SpanContext
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext ctx中的span，没有时返回nil
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext 服务端：把调用方的span作为之后创建的span的父span
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext 当前的父span，ctx中有本地span时优先，否则是调用方的span
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		if sc := span.SpanContext(); sc.IsValid() {
+			return sc
+		}
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Start 用tracer开始span，tracer为nil时不记录，ctx原样返回，已有的trace照常传递给下游
+func Start(ctx context.Context, tracer Tracer, name string, opts ...SpanOption) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return tracer.Start(ctx, name, opts...)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext   { return SpanContext{} }
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}